@@ -2,4 +2,8 @@ module video_compressor
 
 go 1.22.2
 
-require github.com/fvbommel/sortorder v1.1.0 // indirect
+require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/fvbommel/sortorder v1.1.0
+	gopkg.in/yaml.v3 v3.0.1
+)
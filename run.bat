@@ -15,17 +15,11 @@ set /p OUTPUT_FILE=Enter output file name:
 
 REM Set default parameters
 set "MODE=compress"
-set "FPS=32"
-set "RESOLUTION=1080p"
-set "BITRATE=0"
-set "PRESET=p3"
-set "CQ=16"
-REM If width and height are set, resolution will be ignored (0 is auto)
-set "WIDTH=0"
-set "HEIGHT=0"
-set "ENCODER=gpu"
-REM mp4, mkv, avi, flv, webm, mov, wmv, ts
-set "OUTPUT_EXTENSION=mp4"
+REM Encoding settings come from video_compressor.json (.yaml, .yml or .toml) in this folder
+REM if present; set CONFIG to use another file
+set "CONFIG="
+REM Named profile: web, archive, chat-25mb, phone or a profile from the config file (empty for none)
+set "PROFILE="
 
 REM Display current parameters
 echo ================================================
@@ -33,15 +27,9 @@ echo(!GREEN!Current parameters:!NC!
 echo Input file:         %INPUT_FILE%
 echo Output file:        %OUTPUT_FILE%
 echo Mode:               %MODE%
-echo Frame rate:         %FPS%
-echo Resolution:         %RESOLUTION%
-echo Bitrate:            %BITRATE%
-echo Preset:             %PRESET%
-echo Quality value (CQ): %CQ%
-echo Width:              %WIDTH%
-echo Height:             %HEIGHT%
-echo Encoder:            %ENCODER%
-echo Output extension:   %OUTPUT_EXTENSION%
+echo Profile:            %PROFILE%
+echo Effective settings:
+video_compressor.exe config show -config "%CONFIG%" -profile "%PROFILE%"
 echo ================================================
 
 REM Check if input file exists
@@ -58,19 +46,11 @@ if not exist "%OUTPUT_DIR%" (
 )
 
 REM Run video compressor
-video_compressor.exe ^
+video_compressor.exe %MODE% ^
     -input "%INPUT_FILE%" ^
     -output "%OUTPUT_FILE%" ^
-    -mode "%MODE%" ^
-    -fps %FPS% ^
-    -resolution "%RESOLUTION%" ^
-    -bitrate %BITRATE% ^
-    -preset "%PRESET%" ^
-    -cq %CQ% ^
-    -width %WIDTH% ^
-    -height %HEIGHT% ^
-    -encoder "%ENCODER%" ^
-    -output-extension "%OUTPUT_EXTENSION%"
+    -config "%CONFIG%" ^
+    -profile "%PROFILE%"
 
 REM Check exit status and display result
 if %ERRORLEVEL% equ 0 (
@@ -12,17 +12,11 @@ read -p "Enter output file name: " OUTPUT_FILE
 
 # Set default parameters
 MODE="compress"
-FPS=32
-RESOLUTION="1080p"
-BITRATE=0
-PRESET="p3"
-CQ=16
-# If width and height are set, resolution will be ignored (0 is auto)
-WIDTH=0
-HEIGHT=0
-ENCODER="gpu"
-# mp4, mkv, avi, flv, webm, mov, wmv, ts
-OUTPUT_EXTENSION="mp4"
+# Encoding settings come from video_compressor.json (.yaml, .yml or .toml) in this folder
+# if present; set CONFIG to use another file
+CONFIG=""
+# Named profile: web, archive, chat-25mb, phone or a profile from the config file (empty for none)
+PROFILE=""
 
 # Display current parameters
 echo ================================================
@@ -30,15 +24,9 @@ echo -e "${GREEN}Current parameters:${NC}"
 echo "Input file: $INPUT_FILE"
 echo "Output file: $OUTPUT_FILE"
 echo "Mode: $MODE"
-echo "Frame rate: $FPS"
-echo "Resolution: $RESOLUTION"
-echo "Bitrate: $BITRATE"
-echo "Preset: $PRESET"
-echo "Quality value: $CQ"
-echo "Width: $WIDTH"
-echo "Height: $HEIGHT"
-echo "Encoder: $ENCODER"
-echo "Output extension: $OUTPUT_EXTENSION"
+echo "Profile: ${PROFILE:-none}"
+echo "Effective settings:"
+./video_compressor config show -config "$CONFIG" -profile "$PROFILE"
 echo ================================================
 
 # Check if input file exists
@@ -53,19 +41,11 @@ if [ ! -d "$OUTPUT_DIR" ]; then
     mkdir -p "$OUTPUT_DIR"
 fi
 
-if ./video_compressor \
-  -input      "$INPUT_FILE" \
-  -output     "$OUTPUT_FILE" \
-  -mode       "$MODE" \
-  -fps        "$FPS" \
-  -resolution "$RESOLUTION" \
-  -bitrate    "$BITRATE" \
-  -preset     "$PRESET" \
-  -cq         "$CQ" \
-  -width      "$WIDTH" \
-  -height     "$HEIGHT" \
-  -encoder    "$ENCODER" \
-  -output-extension  "$OUTPUT_EXTENSION"
+if ./video_compressor "$MODE" \
+  -input   "$INPUT_FILE" \
+  -output  "$OUTPUT_FILE" \
+  -config  "$CONFIG" \
+  -profile "$PROFILE"
 then
     echo -e "${GREEN}Video compression completed!${NC}"
 else
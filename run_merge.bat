@@ -7,19 +7,11 @@ set /p OUTPUT_FILE=Enter output file name:
 
 :: Default parameters
 set MODE=merge
-set FPS=32
-set RESOLUTION=
-set BITRATE=0
-@REM p1 - p7 (p7 is the best quality)
-set PRESET=p3
-set CQ=16
-@REM 0 is auto (If width and height are set >0, resolution will be ignored)
-set WIDTH=0
-set HEIGHT=0
-@REM gpu, cpu
-set ENCODER=gpu
-@REM mp4, mkv, avi, flv, webm, mov, wmv, ts
-set OUTPUT_EXTENSION=mp4
+@REM Encoding settings come from video_compressor.json (.yaml, .yml or .toml) in this folder
+@REM if present; set CONFIG to use another file
+set "CONFIG="
+@REM Named profile: web, archive, chat-25mb, phone or a profile from the config file (empty for none)
+set "PROFILE="
 @REM reverse the order of the files to be merged
 set REVERSE=false
 
@@ -29,16 +21,10 @@ echo Current parameters:
 echo Input file:           %INPUT_FILE%
 echo Output file:          %OUTPUT_FILE%
 echo Mode:                 %MODE%
-echo Frame rate:           %FPS%
-echo Resolution:           %RESOLUTION%
-echo Bitrate:              %BITRATE%
-echo Preset:               %PRESET%
-echo Quality value (CQ):   %CQ%
-echo Width:                %WIDTH%
-echo Height:               %HEIGHT%
-echo Encoder:              %ENCODER%
-echo Output extension:     %OUTPUT_EXTENSION%
+echo Profile:              %PROFILE%
 echo Reverse:              %REVERSE%
+echo Effective settings:
+if exist video_compressor.exe video_compressor.exe config show -config "%CONFIG%" -profile "%PROFILE%"
 echo ================================================
 
 :: Check if input file or directory exists
@@ -56,20 +42,12 @@ if not exist "%OUTPUT_DIR%" (
 
 :: Run Go program
 if exist video_compressor.exe (
-video_compressor.exe ^
+video_compressor.exe %MODE% ^
     -input "%INPUT_FILE%" ^
     -output "%OUTPUT_FILE%" ^
-    -mode "%MODE%" ^
-    -fps %FPS% ^
-    -resolution "%RESOLUTION%" ^
-    -bitrate %BITRATE% ^
-    -preset "%PRESET%" ^
-    -cq %CQ% ^
-    -width %WIDTH% ^
-    -height %HEIGHT% ^
-    -encoder "%ENCODER%" ^
-      -output-extension "%OUTPUT_EXTENSION%" ^
-      -reverse "%REVERSE%"
+    -config "%CONFIG%" ^
+    -profile "%PROFILE%" ^
+    -reverse=%REVERSE%
 ) else (
     echo Error: video_compressor.exe not found.
     pause
@@ -7,17 +7,11 @@ read -rp "Enter output file name: " OUTPUT_FILE
 
 # Default parameters
 MODE="merge"
-FPS=32
-RESOLUTION=""
-BITRATE=0
-# p1 - p7 (p7 is the best quality)
-PRESET="p3"
-CQ=16
-WIDTH=0      # If width and height are set (>0), resolution will be ignored
-HEIGHT=0
-ENCODER="gpu"
-# mp4, mkv, avi, flv, webm, mov, wmv, ts
-OUTPUT_EXTENSION="mp4"
+# Encoding settings come from video_compressor.json (.yaml, .yml or .toml) in this folder
+# if present; set CONFIG to use another file
+CONFIG=""
+# Named profile: web, archive, chat-25mb, phone or a profile from the config file (empty for none)
+PROFILE=""
 # Reverse the order of the files to be merged
 REVERSE=false
 
@@ -27,16 +21,10 @@ echo "Current parameters:"
 echo "Input file: $INPUT_FILE"
 echo "Output file: $OUTPUT_FILE"
 echo "Mode: $MODE"
-echo "Frame rate: $FPS"
-echo "Resolution: $RESOLUTION"
-echo "Bitrate: $BITRATE"
-echo "Preset: $PRESET"
-echo "Quality value: $CQ"
-echo "Width: $WIDTH"
-echo "Height: $HEIGHT"
-echo "Encoder: $ENCODER"
-echo "Output extension: $OUTPUT_EXTENSION"
+echo "Profile: ${PROFILE:-none}"
 echo "Reverse: $REVERSE"
+echo "Effective settings:"
+./video_compressor config show -config "$CONFIG" -profile "$PROFILE"
 echo ================================================
 
 # Check if input file or directory exists
@@ -50,20 +38,12 @@ OUTPUT_DIR=$(dirname "$OUTPUT_FILE")
 mkdir -p "$OUTPUT_DIR"
 
 # Run Go program
-if ./video_compressor \
-  -input      "$INPUT_FILE" \
-  -output     "$OUTPUT_FILE" \
-  -mode       "$MODE" \
-  -fps        "$FPS" \
-  -resolution "$RESOLUTION" \
-  -bitrate    "$BITRATE" \
-  -preset     "$PRESET" \
-  -cq         "$CQ" \
-  -width      "$WIDTH" \
-  -height     "$HEIGHT" \
-  -encoder    "$ENCODER" \
-  -output-extension  "$OUTPUT_EXTENSION" \
-  -reverse    "$REVERSE"
+if ./video_compressor "$MODE" \
+  -input   "$INPUT_FILE" \
+  -output  "$OUTPUT_FILE" \
+  -config  "$CONFIG" \
+  -profile "$PROFILE" \
+  -reverse="$REVERSE"
 then
   echo "Video compression completed!"
 else
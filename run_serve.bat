@@ -0,0 +1,43 @@
+@echo off
+setlocal EnableDelayedExpansion
+
+REM Set color output
+REM Define ESC (escape) character
+for /F "delims=" %%A in ('echo prompt $E ^| cmd') do set "ESC=%%A"
+set "GREEN=!ESC![0;32m"
+set "RED=!ESC![0;31m"
+REM No Color
+set "NC=!ESC![0m"
+
+REM Set default parameters
+REM 127.0.0.1 accepts this computer only; use 0.0.0.0:8080 to accept the whole network
+set "LISTEN=127.0.0.1:8080"
+set "WORKERS=1"
+REM Uploaded videos and compressed outputs are stored here
+set "DATA_DIR=video_compressor_data"
+
+REM Display current parameters
+echo ================================================
+echo(!GREEN!Current parameters:!NC!
+echo Address:            %LISTEN%
+echo Parallel jobs:      %WORKERS%
+echo Data directory:     %DATA_DIR%
+echo ================================================
+echo(!GREEN!Open http://%LISTEN% in a browser and drop videos on the page.!NC!
+echo Press Ctrl-C to stop the server.
+
+REM Run video compressor server
+video_compressor.exe serve ^
+    -listen "%LISTEN%" ^
+    -workers %WORKERS% ^
+    -data "%DATA_DIR%"
+
+REM Check exit status and display result
+if %ERRORLEVEL% equ 0 (
+    echo(!GREEN!Server stopped!%NC%
+) else (
+    echo(!RED!Server failed!%NC%
+)
+
+REM Wait for user to press any key before exiting
+pause
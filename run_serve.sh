@@ -0,0 +1,37 @@
+#!/bin/bash
+
+# Set color output
+GREEN='\033[0;32m'
+RED='\033[0;31m'
+# No Color
+NC='\033[0m'
+
+# Set default parameters
+# 127.0.0.1 accepts this computer only; use 0.0.0.0:8080 to accept the whole network
+LISTEN="127.0.0.1:8080"
+WORKERS=1
+# Uploaded videos and compressed outputs are stored here
+DATA_DIR="video_compressor_data"
+
+# Display current parameters
+echo ================================================
+echo -e "${GREEN}Current parameters:${NC}"
+echo "Address: $LISTEN"
+echo "Parallel jobs: $WORKERS"
+echo "Data directory: $DATA_DIR"
+echo ================================================
+echo -e "${GREEN}Open http://$LISTEN in a browser and drop videos on the page.${NC}"
+echo "Press Ctrl-C to stop the server."
+
+# Run video compressor server
+./video_compressor serve \
+    -listen "$LISTEN" \
+    -workers "$WORKERS" \
+    -data "$DATA_DIR"
+
+# Check exit status and display result
+if [ $? -eq 0 ]; then
+    echo -e "${GREEN}Server stopped${NC}"
+else
+    echo -e "${RED}Server failed${NC}"
+fi
@@ -0,0 +1,980 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"video_compressor/src/config"
+	"video_compressor/src/ffmpeg"
+	"video_compressor/src/jobs"
+	"video_compressor/src/metrics"
+	"video_compressor/src/server"
+	"video_compressor/src/utils"
+	"video_compressor/src/video"
+)
+
+// newFlagSet returns a flag set for a subcommand that prints its usage line and flags
+func newFlagSet(name, args, description string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: video_compressor %s %s\n\n%s\n\nFlags:\n", name, args, description)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses args into fs and returns the exit status to use if parsing
+// did not succeed (ok is false). Errors print a hint instead of the full usage.
+func parseFlags(fs *flag.FlagSet, args []string) (status int, ok bool) {
+	return parseFlagsArgs(fs, args, false)
+}
+
+// parseFlagsArgs is parseFlags for commands taking positional arguments after the flags
+// if positional is set
+func parseFlagsArgs(fs *flag.FlagSet, args []string, positional bool) (status int, ok bool) {
+	fs.SetOutput(io.Discard)
+	err := fs.Parse(args)
+	fs.SetOutput(os.Stderr)
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+		fs.Usage()
+		return exitOK, false
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	case fs.NArg() > 0 && !positional:
+		fmt.Fprintf(os.Stderr, "Error: unexpected argument %q\n", fs.Arg(0))
+	default:
+		return exitOK, true
+	}
+	fmt.Fprintf(os.Stderr, "Run 'video_compressor %s -h' for usage.\n", fs.Name())
+	return exitUsage, false
+}
+
+// fail prints an error and returns the error exit status
+func fail(format string, a ...any) int {
+	fmt.Fprintf(os.Stderr, "Error: "+format+"\n", a...)
+	return exitError
+}
+
+// loadSettings applies the config file and profile to fs and checks the input path
+func loadSettings(fs *flag.FlagSet, o *options) error {
+	if err := applyConfigFile(fs, o.configPath, o.profile); err != nil {
+		return err
+	}
+	o.input = strings.TrimSpace(o.input)
+	o.output = strings.TrimSpace(o.output)
+	if o.input == "" {
+		return fmt.Errorf("-input is required")
+	}
+	if _, err := os.Stat(o.input); err != nil {
+		return fmt.Errorf("input not found: %s", o.input)
+	}
+	return nil
+}
+
+// finalizeConfig resolves the dimension and bitrate defaults
+func finalizeConfig(cfg *config.VideoConfig) {
+	// Custom width/height take precedence over the resolution
+	if cfg.Width != 0 && cfg.Height != 0 {
+		cfg.Resolution = config.ResolutionNone
+		fmt.Println("Custom width/height specified, ignoring resolution")
+	}
+	// Without a custom bitrate, use the recommended one for the resolution
+	if cfg.Bitrate == 0 && cfg.Resolution != config.ResolutionNone {
+		_, _, cfg.Bitrate = utils.GetRecommendedSettings(cfg.Resolution, 0, 0)
+	}
+}
+
+// ensureFFmpeg returns the FFmpeg path, downloading FFmpeg if it is not installed
+func ensureFFmpeg() (string, error) {
+	ffmpegPath, err := ffmpeg.CheckFFmpeg()
+	if err == nil {
+		return ffmpegPath, nil
+	}
+	fmt.Println("FFmpeg not found, attempting to download...")
+	if err := ffmpeg.DownloadFFmpeg(); err != nil {
+		return "", fmt.Errorf("failed to download FFmpeg: %v", err)
+	}
+	ffmpegPath, err = ffmpeg.CheckFFmpeg()
+	if err != nil {
+		return "", fmt.Errorf("FFmpeg still not found after download: %v", err)
+	}
+	return ffmpegPath, nil
+}
+
+// signalContext returns a context cancelled on Ctrl-C or SIGTERM; a second signal
+// terminates immediately
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx, stop
+}
+
+// exitStatus returns the exit status for the result of running a command
+func exitStatus(ctx context.Context, err error) int {
+	if err != nil && ctx.Err() != nil {
+		fmt.Fprintln(os.Stderr, "Interrupted, partial output discarded")
+		return exitInterrupted
+	}
+	if err != nil {
+		return fail("%v", err)
+	}
+	return exitOK
+}
+
+// defaultOutputName returns "<input name>_<time>" followed by ext
+func defaultOutputName(input, ext string) string {
+	base := filepath.Base(input)
+	name := strings.TrimSuffix(base, filepath.Ext(base))
+	return fmt.Sprintf("%s_%s%s", name, time.Now().Format("150405"), ext)
+}
+
+// createParentDir creates the directory containing path
+func createParentDir(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %v", err)
+	}
+	return nil
+}
+
+// openJobs opens the job history at path, the default history if path is empty, or
+// returns nil if path is "none"
+func openJobs(path string) (*jobs.Store, error) {
+	switch strings.TrimSpace(path) {
+	case "none":
+		return nil, nil
+	case "":
+		var err error
+		if path, err = jobs.DefaultPath(); err != nil {
+			return nil, err
+		}
+	}
+	return jobs.Open(strings.TrimSpace(path))
+}
+
+// runCompress implements the compress command
+func runCompress(args []string) int {
+	fs := newFlagSet("compress", "-input <file|dir> [flags]",
+		"Compresses a video, or every video in a directory.")
+	var o options
+	registerCommonFlags(fs, &o, "Input video file or directory", "Output file, or directory when compressing a directory (default: <input>_<time>)")
+	registerRunFlags(fs, &o)
+	registerVideoFlags(fs, &o.cfg)
+	registerCompressFlags(fs, &o.cfg)
+	registerJobFlags(fs, &o, true)
+	if status, ok := parseFlags(fs, args); !ok {
+		return status
+	}
+	defer o.quietOutput()()
+	if err := loadSettings(fs, &o); err != nil {
+		return fail("%v", err)
+	}
+	if err := validateConfig(o.cfg); err != nil {
+		return fail("%v", err)
+	}
+	finalizeConfig(&o.cfg)
+	store, err := openJobs(o.jobsPath)
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	ffmpegPath, err := ensureFFmpeg()
+	if err != nil {
+		return fail("%v", err)
+	}
+	o.cfg.FfmpegPath = ffmpegPath
+
+	// A directory compresses every video in it
+	info, _ := os.Stat(o.input)
+	batch := info.IsDir()
+	if o.output == "" && batch {
+		o.output = defaultOutputName(o.input, "")
+	} else if o.output == "" {
+		o.output = defaultOutputName(o.input, o.cfg.OutputExtension)
+	}
+	if !o.cfg.DryRun {
+		if err := createParentDir(o.output); err != nil {
+			return fail("%v", err)
+		}
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	var results []*video.Result
+	if batch {
+		results, err = video.CompressDirectory(ctx, o.input, o.output, o.cfg, !o.quiet, store, o.reprocess)
+	} else {
+		// A single file is compressed even if it was processed before
+		var result *video.Result
+		result, err = video.CompressTracked(ctx, store, o.input, o.output, o.cfg, !o.quiet, false)
+		results = append(results, result)
+	}
+	printRunReport(results)
+	if reportErr := o.writeReport(results, batch); reportErr != nil && err == nil {
+		err = reportErr
+	}
+	return exitStatus(ctx, err)
+}
+
+// runMerge implements the merge command
+func runMerge(args []string) int {
+	fs := newFlagSet("merge", "-input <dir> [flags]",
+		"Merges the videos in a directory, in natural file name order, into one file.")
+	var o options
+	registerCommonFlags(fs, &o, "Directory containing the videos to merge", "Output file (default: <input>_<time>)")
+	registerRunFlags(fs, &o)
+	registerVideoFlags(fs, &o.cfg)
+	registerMergeFlags(fs, &o.cfg)
+	if status, ok := parseFlags(fs, args); !ok {
+		return status
+	}
+	defer o.quietOutput()()
+	if err := loadSettings(fs, &o); err != nil {
+		return fail("%v", err)
+	}
+	if err := validateConfig(o.cfg); err != nil {
+		return fail("%v", err)
+	}
+	if info, _ := os.Stat(o.input); !info.IsDir() {
+		return fail("merge input must be a directory: %s", o.input)
+	}
+	finalizeConfig(&o.cfg)
+
+	ffmpegPath, err := ensureFFmpeg()
+	if err != nil {
+		return fail("%v", err)
+	}
+	o.cfg.FfmpegPath = ffmpegPath
+
+	if o.output == "" {
+		o.output = defaultOutputName(o.input, o.cfg.OutputExtension)
+	}
+	if !o.cfg.DryRun {
+		if err := createParentDir(o.output); err != nil {
+			return fail("%v", err)
+		}
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+	result, err := video.MergeVideos(ctx, o.input, o.output, o.cfg, !o.quiet)
+	if reportErr := o.writeReport([]*video.Result{result}, false); reportErr != nil && err == nil {
+		err = reportErr
+	}
+	return exitStatus(ctx, err)
+}
+
+// runWatch implements the watch command
+func runWatch(args []string) int {
+	fs := newFlagSet("watch", "-input <dir> [-input <dir>...] -output <dir> [flags]",
+		"Polls the input directories and compresses every new video once its size has been\n"+
+			"stable for -stable seconds. Originals are moved to the done/ or failed/ folder of\n"+
+			"their directory. Accepts the flags of compress. Stop with Ctrl-C.")
+	var o options
+	var dirs []string
+	fs.Var(pathListValue{&dirs}, "input", "Directory to watch; repeat or separate with commas for several")
+	fs.StringVar(&o.output, "output", "", "Output directory")
+	fs.StringVar(&o.configPath, "config", "", configUsage)
+	fs.StringVar(&o.profile, "profile", "", "Named settings profile (built-in: archive, chat-25mb, phone, web)")
+	interval := fs.Float64("interval", 5, "Seconds between directory scans")
+	stable := fs.Float64("stable", 10, "Seconds a file must stay unchanged before it is processed")
+	stateFile := fs.String("state", "", "Queue file (default: "+video.DefaultWatchStateFile+" in the output directory)")
+	fs.BoolVar(&o.quiet, "quiet", false, "Print only the files processed, not the FFmpeg progress")
+	metricsListen := fs.String("metrics-listen", "", "Address serving Prometheus metrics on /metrics and a health check on /healthz (e.g. 127.0.0.1:9090)")
+	registerVideoFlags(fs, &o.cfg)
+	registerCompressFlags(fs, &o.cfg)
+	registerJobFlags(fs, &o, true)
+	if status, ok := parseFlags(fs, args); !ok {
+		return status
+	}
+	if err := applyConfigFile(fs, o.configPath, o.profile); err != nil {
+		return fail("%v", err)
+	}
+	if err := validateConfig(o.cfg); err != nil {
+		return fail("%v", err)
+	}
+	if len(dirs) == 0 || strings.TrimSpace(o.output) == "" {
+		return fail("-input and -output are required")
+	}
+	if *interval <= 0 || *stable < 0 {
+		return fail("-interval must be positive and -stable must not be negative")
+	}
+	finalizeConfig(&o.cfg)
+	store, err := openJobs(o.jobsPath)
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	ffmpegPath, err := ensureFFmpeg()
+	if err != nil {
+		return fail("%v", err)
+	}
+	o.cfg.FfmpegPath = ffmpegPath
+
+	ctx, stop := signalContext()
+	defer stop()
+	var registry *metrics.Registry
+	if *metricsListen != "" {
+		registry = metrics.New()
+		mux := http.NewServeMux()
+		metrics.Register(mux, registry, ffmpegPath)
+		// Listen before watching so that an unusable address fails at startup
+		listener, err := net.Listen("tcp", *metricsListen)
+		if err != nil {
+			return fail("%v", err)
+		}
+		metricsServer := &http.Server{Handler: mux}
+		defer metricsServer.Close()
+		go metricsServer.Serve(listener)
+		fmt.Printf("Serving metrics on http://%s/metrics\n", *metricsListen)
+	}
+	err = video.Watch(ctx, video.WatchOptions{
+		Dirs:      dirs,
+		OutputDir: strings.TrimSpace(o.output),
+		Interval:  time.Duration(*interval * float64(time.Second)),
+		StableFor: time.Duration(*stable * float64(time.Second)),
+		StateFile: *stateFile,
+		Jobs:      store,
+		Reprocess: o.reprocess,
+		Metrics:   registry,
+		Verbose:   !o.quiet,
+	}, o.cfg)
+	return exitStatus(ctx, err)
+}
+
+// runEstimate implements the estimate command
+func runEstimate(args []string) int {
+	fs := newFlagSet("estimate", "-input <file|dir> [flags]",
+		"Encodes short samples spread across each input with the effective settings and\n"+
+			"extrapolates the output size and encode time. Accepts the flags of compress.")
+	var o options
+	registerCommonFlags(fs, &o, "Input video file or directory", "")
+	samples := fs.Int("samples", 3, "Number of samples per input")
+	sampleLength := fs.Float64("sample-length", 10, "Length of each sample in seconds")
+	registerVideoFlags(fs, &o.cfg)
+	registerCompressFlags(fs, &o.cfg)
+	if status, ok := parseFlags(fs, args); !ok {
+		return status
+	}
+	if err := loadSettings(fs, &o); err != nil {
+		return fail("%v", err)
+	}
+	if err := validateConfig(o.cfg); err != nil {
+		return fail("%v", err)
+	}
+	if *samples < 1 || *sampleLength <= 0 {
+		return fail("-samples and -sample-length must be positive")
+	}
+	finalizeConfig(&o.cfg)
+
+	ffmpegPath, err := ensureFFmpeg()
+	if err != nil {
+		return fail("%v", err)
+	}
+	o.cfg.FfmpegPath = ffmpegPath
+
+	ctx, stop := signalContext()
+	defer stop()
+	var estimates []*video.Estimate
+	if info, _ := os.Stat(o.input); info.IsDir() {
+		estimates, err = video.EstimateDirectory(ctx, o.input, o.cfg, *samples, *sampleLength)
+	} else {
+		var estimate *video.Estimate
+		if estimate, err = video.EstimateVideo(ctx, o.input, o.cfg, *samples, *sampleLength); err == nil {
+			estimates = append(estimates, estimate)
+		}
+	}
+	printEstimates(estimates)
+	return exitStatus(ctx, err)
+}
+
+// printEstimates prints the estimate of every input and the total of several inputs
+func printEstimates(estimates []*video.Estimate) {
+	if len(estimates) == 0 {
+		return
+	}
+	fmt.Println("================================================")
+	fmt.Println("Estimate:")
+	total := &video.Estimate{Input: "total"}
+	for _, e := range estimates {
+		if e.Reason != "" {
+			fmt.Printf("  %s: skipped, %s\n", e.Input, e.Reason)
+		} else {
+			fmt.Printf("  %s: %.2fMB → ~%.2fMB (%.1f%%), ~%s encode from %d samples\n", e.Input,
+				float64(e.InputSize)/1024/1024, float64(e.Size)/1024/1024, e.Reduction(), formatSeconds(e.EncodeTime), e.Samples)
+		}
+		total.InputSize += e.InputSize
+		total.Size += e.Size
+		total.EncodeTime += e.EncodeTime
+	}
+	if len(estimates) > 1 {
+		fmt.Printf("  Total: %.2fMB → ~%.2fMB (%.1f%%), ~%s encode\n",
+			float64(total.InputSize)/1024/1024, float64(total.Size)/1024/1024, total.Reduction(), formatSeconds(total.EncodeTime))
+	}
+}
+
+// formatSeconds formats a number of seconds as a duration such as 1h2m3s
+func formatSeconds(seconds float64) string {
+	return time.Duration(seconds * float64(time.Second)).Round(time.Second).String()
+}
+
+// runProbe implements the probe command
+func runProbe(args []string) int {
+	fs := newFlagSet("probe", "-input <file> [flags]",
+		"Prints the properties and streams of a video.")
+	input := fs.String("input", "", "Input video file")
+	asJSON := fs.Bool("json", false, "Print the result as JSON")
+	if status, ok := parseFlags(fs, args); !ok {
+		return status
+	}
+	if *input == "" {
+		return fail("-input is required")
+	}
+	if _, err := os.Stat(*input); err != nil {
+		return fail("input not found: %s", *input)
+	}
+	if _, err := ensureFFmpeg(); err != nil {
+		return fail("%v", err)
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+	info, err := utils.ProbeVideo(ctx, *input)
+	if err != nil {
+		return exitStatus(ctx, err)
+	}
+	if *asJSON {
+		data, _ := json.MarshalIndent(info, "", "  ")
+		fmt.Println(string(data))
+		return exitOK
+	}
+	printVideoInfo(*input, info)
+	return exitOK
+}
+
+// printVideoInfo prints a human-readable summary of a probed video
+func printVideoInfo(path string, info utils.VideoInfo) {
+	width, height := info.DisplayDimensions()
+	fmt.Printf("File:       %s\n", path)
+	fmt.Printf("Duration:   %.2fs\n", info.Duration)
+	fmt.Printf("Video:      %s %dx%d, %.3g fps, %d kb/s, %s\n", info.Codec, width, height,
+		info.FrameRate, info.BitRate/1000, info.PixelFormat)
+	if info.Rotation != 0 {
+		fmt.Printf("Rotation:   %d°\n", info.Rotation)
+	}
+	if info.IsHDR() {
+		fmt.Printf("HDR:        %s / %s\n", info.ColorTransfer, info.ColorPrimaries)
+	}
+	if info.CreationTime != "" {
+		fmt.Printf("Created:    %s\n", info.CreationTime)
+	}
+	fmt.Println("Streams:")
+	for _, s := range info.Streams {
+		lang := s.Language
+		if lang == "" {
+			lang = "und"
+		}
+		fmt.Printf("  #%-3d %-10s %-12s %s\n", s.Index, s.Type, s.Codec, lang)
+	}
+}
+
+// runSplit implements the split command
+func runSplit(args []string) int {
+	fs := newFlagSet("split", "-input <file> (-duration <seconds> | -parts <n>) [flags]",
+		"Splits a video into segments at keyframes without re-encoding.")
+	var o options
+	registerCommonFlags(fs, &o, "Input video file", "Output directory (default: <input>_<time>)")
+	duration := fs.Float64("duration", 0, "Segment length in seconds")
+	parts := fs.Int("parts", 0, "Number of segments of equal length")
+	choiceVar(fs, &o.cfg.Overwrite, "overwrite", "never", []string{"never", "always", "if-smaller"}, config.StringToOverwritePolicy, "Existing output handling")
+	fs.BoolVar(&o.cfg.PreserveMetadata, "metadata", true, "Preserve metadata and file timestamps")
+	fs.BoolVar(&o.cfg.CopyXattrs, "xattrs", false, "Copy extended file attributes to the output (Linux only)")
+	if status, ok := parseFlags(fs, args); !ok {
+		return status
+	}
+	if err := loadSettings(fs, &o); err != nil {
+		return fail("%v", err)
+	}
+	if (*duration > 0) == (*parts > 0) {
+		return fail("exactly one of -duration and -parts must be positive")
+	}
+
+	ffmpegPath, err := ensureFFmpeg()
+	if err != nil {
+		return fail("%v", err)
+	}
+	o.cfg.FfmpegPath = ffmpegPath
+	if o.output == "" {
+		o.output = defaultOutputName(o.input, "")
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+	var files []string
+	if *parts > 0 {
+		files, err = video.SplitVideoParts(ctx, o.input, o.output, *parts, o.cfg)
+	} else {
+		files, err = video.SplitVideo(ctx, o.input, o.output, *duration, o.cfg)
+	}
+	for _, f := range files {
+		fmt.Println(f)
+	}
+	return exitStatus(ctx, err)
+}
+
+// runConfig implements the config command
+func runConfig(args []string) int {
+	if len(args) == 0 || isHelp(args[0]) {
+		fmt.Fprintln(os.Stderr, "Usage: video_compressor config <show|profiles> [flags]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "  show      Print the effective configuration as a config file")
+		fmt.Fprintln(os.Stderr, "  profiles  List the built-in profiles and the profiles of the config file")
+		if len(args) == 0 {
+			return exitUsage
+		}
+		return exitOK
+	}
+
+	switch args[0] {
+	case "show":
+		fs := newFlagSet("config show", "[flags]",
+			"Prints the effective configuration (config file, profile and flags) as a config file.")
+		var o options
+		fs.StringVar(&o.configPath, "config", "", configUsage)
+		fs.StringVar(&o.profile, "profile", "", "Named settings profile")
+		registerSettingFlags(fs, &o.cfg)
+		if status, ok := parseFlags(fs, args[1:]); !ok {
+			return status
+		}
+		if err := applyConfigFile(fs, o.configPath, o.profile); err != nil {
+			return fail("%v", err)
+		}
+		printConfig(fs)
+		return exitOK
+	case "profiles":
+		fs := newFlagSet("config profiles", "[flags]", "Lists the available profiles.")
+		configPath := fs.String("config", "", configUsage)
+		if status, ok := parseFlags(fs, args[1:]); !ok {
+			return status
+		}
+		file, err := loadConfigFile(*configPath)
+		if err != nil {
+			return fail("%v", err)
+		}
+		for _, name := range config.ProfileNames(file) {
+			fmt.Println(name)
+		}
+		return exitOK
+	default:
+		return fail("unknown config command %q%s", args[0], suggestion(args[0], []string{"show", "profiles"}))
+	}
+}
+
+// runServe implements the serve command
+func runServe(args []string) int {
+	fs := newFlagSet("serve", "[flags]",
+		"Serves a web page and a REST API to submit compression jobs (a file path on this\n"+
+			"machine or an upload, with a profile or inline settings), follow their progress,\n"+
+			"cancel them and download the outputs. Jobs are recorded in the job history.\n"+
+			"Prometheus metrics are served on /metrics and an FFmpeg health check on /healthz.\n"+
+			"Stop with Ctrl-C; interrupted jobs run again at the next start.")
+	var o options
+	listen := fs.String("listen", "127.0.0.1:8080", "Address to listen on (e.g. :8080 to accept connections from the network)")
+	dataDir := fs.String("data", "video_compressor_data", "Directory for uploaded inputs and outputs")
+	workers := fs.Int("workers", 1, "Number of jobs compressed at the same time")
+	maxUpload := fs.Int64("max-upload", server.DefaultMaxUpload>>20, "Largest accepted upload in MB; larger requests are rejected with 413")
+	fs.StringVar(&o.configPath, "config", "", configUsage)
+	fs.BoolVar(&o.quiet, "quiet", false, "Do not print the FFmpeg output of the jobs")
+	registerJobFlags(fs, &o, false)
+	if status, ok := parseFlags(fs, args); !ok {
+		return status
+	}
+	if *workers < 1 {
+		return fail("-workers must be at least 1")
+	}
+	if *maxUpload < 1 {
+		return fail("-max-upload must be at least 1")
+	}
+	// Report config file errors at startup rather than on every submission
+	file, err := loadConfigFile(o.configPath)
+	if err != nil {
+		return fail("%v", err)
+	}
+	if o.jobsPath == "none" {
+		return fail("the server needs a job history")
+	}
+	store, err := openJobs(o.jobsPath)
+	if err != nil {
+		return fail("%v", err)
+	}
+	ffmpegPath, err := ensureFFmpeg()
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	srv, err := server.New(server.Options{
+		Store:      store,
+		DataDir:    *dataDir,
+		Workers:    *workers,
+		MaxUpload:  *maxUpload << 20,
+		Verbose:    !o.quiet,
+		Metrics:    metrics.New(),
+		FfmpegPath: ffmpegPath,
+		Profiles:   config.ProfileNames(file),
+		Resolve:    jobConfigResolver(o.configPath, ffmpegPath),
+	})
+	if err != nil {
+		return fail("%v", err)
+	}
+	ctx, stop := signalContext()
+	defer stop()
+	if err := srv.Start(ctx); err != nil {
+		return fail("%v", err)
+	}
+	// Requests share the signal context, so event streams end on shutdown
+	httpServer := &http.Server{
+		Addr:        *listen,
+		Handler:     srv.Handler(),
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	errc := make(chan error, 1)
+	go func() { errc <- httpServer.ListenAndServe() }()
+	fmt.Printf("Serving the web page and API on http://%s (job history: %s)\n", *listen, store.Path())
+
+	select {
+	case err = <-errc:
+		stop()
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}
+	srv.Wait()
+	if err != nil {
+		return fail("%v", err)
+	}
+	fmt.Println("Server stopped")
+	return exitOK
+}
+
+// jobConfigResolver returns the settings of jobs submitted to the server. Inline settings
+// take precedence over the profile, which takes precedence over the config file.
+func jobConfigResolver(configPath, ffmpegPath string) func(profile string, settings config.Settings) (config.VideoConfig, error) {
+	return func(profile string, settings config.Settings) (config.VideoConfig, error) {
+		fs := flag.NewFlagSet("job", flag.ContinueOnError)
+		var cfg config.VideoConfig
+		registerVideoFlags(fs, &cfg)
+		registerCompressFlags(fs, &cfg)
+		known := settingNames()
+		for name, value := range settings {
+			if !slices.Contains(known, name) {
+				return cfg, fmt.Errorf("unknown setting %q%s", name, suggestion(name, known))
+			}
+			if fs.Lookup(name) == nil {
+				return cfg, fmt.Errorf("setting %q does not apply to compression", name)
+			}
+			if err := fs.Set(name, value); err != nil {
+				return cfg, fmt.Errorf("invalid value %q for %s: %v", value, name, err)
+			}
+		}
+		if err := applyConfigFile(fs, configPath, profile); err != nil {
+			return cfg, err
+		}
+		if err := validateConfig(cfg); err != nil {
+			return cfg, err
+		}
+		finalizeConfig(&cfg)
+		cfg.FfmpegPath = ffmpegPath
+		return cfg, nil
+	}
+}
+
+// jobsCommands lists the subcommands of the jobs command
+var jobsCommands = []string{"list", "retry", "cancel", "purge"}
+
+// runJobs implements the jobs command
+func runJobs(args []string) int {
+	if len(args) == 0 || isHelp(args[0]) {
+		fmt.Fprintln(os.Stderr, "Usage: video_compressor jobs <list|retry|cancel|purge> [flags]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "  list    List the jobs of the history")
+		fmt.Fprintln(os.Stderr, "  retry   Run failed jobs again with their recorded settings")
+		fmt.Fprintln(os.Stderr, "  cancel  Cancel queued or running jobs")
+		fmt.Fprintln(os.Stderr, "  purge   Remove finished jobs from the history")
+		if len(args) == 0 {
+			return exitUsage
+		}
+		return exitOK
+	}
+
+	var o options
+	var statuses []string
+	var fs *flag.FlagSet
+	var asJSON, positional bool
+	var olderThan time.Duration
+	switch args[0] {
+	case "list":
+		fs = newFlagSet("jobs list", "[flags]", "Lists the jobs of the history, oldest first.")
+		fs.Var(listValue{&statuses}, "status", "Comma-separated statuses to list (options: queued, running, succeeded, failed, cancelled)")
+		fs.BoolVar(&asJSON, "json", false, "Print the jobs as JSON")
+	case "retry":
+		fs = newFlagSet("jobs retry", "[flags] [id...]",
+			"Runs the given failed or cancelled jobs again, or every failed job if no ID is given.")
+		fs.BoolVar(&o.quiet, "quiet", false, "Print only the run report, not the FFmpeg progress")
+		positional = true
+	case "cancel":
+		fs = newFlagSet("jobs cancel", "[flags] <id...>",
+			"Cancels queued or running jobs. A running job stops within a few seconds.")
+		positional = true
+	case "purge":
+		fs = newFlagSet("jobs purge", "[flags]", "Removes finished jobs from the history.")
+		fs.Var(listValue{&statuses}, "status", "Comma-separated statuses to remove (default: succeeded, failed, cancelled)")
+		fs.DurationVar(&olderThan, "older-than", 0, "Remove only jobs finished longer ago than this, e.g. 720h")
+	default:
+		return fail("unknown jobs command %q%s", args[0], suggestion(args[0], jobsCommands))
+	}
+	registerJobFlags(fs, &o, false)
+	if status, ok := parseFlagsArgs(fs, args[1:], positional); !ok {
+		return status
+	}
+	filter := make(map[jobs.Status]bool)
+	for _, s := range statuses {
+		status, err := jobs.StringToStatus(s)
+		if err != nil {
+			return fail("%v", err)
+		}
+		filter[status] = true
+	}
+	if o.jobsPath == "none" {
+		return fail("the jobs command needs a job history")
+	}
+	store, err := openJobs(o.jobsPath)
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	switch args[0] {
+	case "list":
+		return listJobs(store, filter, asJSON)
+	case "retry":
+		return retryJobs(store, fs.Args(), !o.quiet)
+	case "cancel":
+		if fs.NArg() == 0 {
+			return fail("no job IDs given")
+		}
+		status := exitOK
+		for _, id := range fs.Args() {
+			if _, err := store.Cancel(id); err != nil {
+				status = fail("%v", err)
+				continue
+			}
+			fmt.Printf("Cancelled job %s\n", id)
+		}
+		return status
+	default:
+		if len(filter) == 0 {
+			filter = map[jobs.Status]bool{jobs.StatusSucceeded: true, jobs.StatusFailed: true, jobs.StatusCancelled: true}
+		}
+		for status := range filter {
+			if !status.Finished() {
+				return fail("only finished jobs can be purged, not %s ones", status)
+			}
+		}
+		cutoff := time.Now().Add(-olderThan)
+		n, err := store.Remove(func(job jobs.Job) bool {
+			return filter[job.Status] && job.Finished.Before(cutoff)
+		})
+		if err != nil {
+			return fail("%v", err)
+		}
+		fmt.Printf("Purged %d jobs from %s\n", n, store.Path())
+		return exitOK
+	}
+}
+
+// listJobs prints the jobs whose status is in filter, or all jobs if filter is empty
+func listJobs(store *jobs.Store, filter map[jobs.Status]bool, asJSON bool) int {
+	all, err := store.List()
+	if err != nil {
+		return fail("%v", err)
+	}
+	list := []jobs.Job{}
+	for _, job := range all {
+		if len(filter) == 0 || filter[job.Status] {
+			list = append(list, job)
+		}
+	}
+	if asJSON {
+		data, _ := json.MarshalIndent(list, "", "  ")
+		fmt.Println(string(data))
+		return exitOK
+	}
+	if len(list) == 0 {
+		fmt.Println("No jobs")
+		return exitOK
+	}
+	fmt.Printf("%-12s  %-9s  %-8s  %-16s  %-21s  %s\n", "ID", "STATUS", "ATTEMPTS", "UPDATED", "SIZE", "INPUT")
+	for _, job := range list {
+		size := fmt.Sprintf("%.1fMB", float64(job.InputSize)/1024/1024)
+		if job.Written != "" {
+			size += fmt.Sprintf(" → %.1fMB", float64(job.OutputSize)/1024/1024)
+		}
+		fmt.Printf("%-12s  %-9s  %-8d  %-16s  %-21s  %s\n", job.ID, job.Status, job.Attempts,
+			job.Updated().Format("2006-01-02 15:04"), size, job.Input)
+		if job.Error != "" {
+			fmt.Printf("%-12s  %s\n", "", job.Error)
+		}
+	}
+	return exitOK
+}
+
+// retryJobs runs the given jobs, or every failed job if ids is empty, again
+func retryJobs(store *jobs.Store, ids []string, verbose bool) int {
+	var retry []jobs.Job
+	if len(ids) == 0 {
+		all, err := store.List()
+		if err != nil {
+			return fail("%v", err)
+		}
+		for _, job := range all {
+			if job.Status == jobs.StatusFailed {
+				retry = append(retry, job)
+			}
+		}
+		if len(retry) == 0 {
+			fmt.Println("No failed jobs")
+			return exitOK
+		}
+	}
+	for _, id := range ids {
+		job, err := store.Get(id)
+		if err != nil {
+			return fail("%v", err)
+		}
+		if job.Status != jobs.StatusFailed && job.Status != jobs.StatusCancelled {
+			return fail("job %s is %s; only failed or cancelled jobs can be retried", job.ID, job.Status)
+		}
+		retry = append(retry, job)
+	}
+
+	ffmpegPath, err := ensureFFmpeg()
+	if err != nil {
+		return fail("%v", err)
+	}
+	ctx, stop := signalContext()
+	defer stop()
+
+	var results []*video.Result
+	failed := 0
+	for i, job := range retry {
+		if ctx.Err() != nil {
+			break
+		}
+		fmt.Printf("[%d/%d] job %s: %s\n", i+1, len(retry), job.ID, job.Input)
+		job.Config.FfmpegPath = ffmpegPath
+		result, err := video.RunJob(ctx, store, job, verbose)
+		if err != nil {
+			fmt.Printf("❌ Error processing %s: %v\n", job.Input, err)
+			failed++
+		}
+		results = append(results, result)
+	}
+	printRunReport(results)
+	if failed > 0 {
+		err = fmt.Errorf("%d of %d jobs failed", failed, len(retry))
+	}
+	return exitStatus(ctx, err)
+}
+
+// printConfig prints the effective value of every setting of fs as a config file
+func printConfig(fs *flag.FlagSet) {
+	settings := make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name != "config" && f.Name != "profile" {
+			settings[f.Name] = f.Value.String()
+		}
+	})
+	data, _ := json.MarshalIndent(settings, "", "  ")
+	fmt.Println(string(data))
+}
+
+// quietOutput discards standard output if -quiet is set, keeping the original for the
+// report. Errors are still printed to standard error. The returned function restores it.
+func (o *options) quietOutput() (restore func()) {
+	o.stdout = os.Stdout
+	if !o.quiet {
+		return func() {}
+	}
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		return func() {}
+	}
+	os.Stdout = devNull
+	return func() {
+		os.Stdout = o.stdout
+		devNull.Close()
+	}
+}
+
+// writeReport writes the -report file ("-" for standard output); batches are
+// written as JSON Lines
+func (o *options) writeReport(results []*video.Result, lines bool) error {
+	if o.report == "" {
+		return nil
+	}
+	if o.report == "-" {
+		return video.WriteReport(o.stdout, results, lines)
+	}
+	f, err := os.Create(o.report)
+	if err != nil {
+		return fmt.Errorf("failed to create report: %v", err)
+	}
+	if err := video.WriteReport(f, results, lines); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write report: %v", err)
+	}
+	return f.Close()
+}
+
+// printRunReport prints the decision taken for every processed input
+func printRunReport(results []*video.Result) {
+	if len(results) == 0 {
+		return
+	}
+	fmt.Println("================================================")
+	fmt.Println("Run report:")
+	for _, r := range results {
+		switch r.Decision {
+		case video.DecisionEncoded:
+			fmt.Printf("  %-13s %s → %s (%.2fMB → %.2fMB, %.2f%%)\n", r.Decision, r.Input, r.Output,
+				float64(r.InputSize)/1024/1024, float64(r.OutputSize)/1024/1024, r.Reduction())
+		case video.DecisionPlanned:
+			fmt.Printf("  %-13s %s → %s\n", r.Decision, r.Input, r.Output)
+		case video.DecisionSkipped, video.DecisionDiscarded:
+			kept := "original kept"
+			if r.Output != "" {
+				kept = "original copied to " + r.Output
+			}
+			fmt.Printf("  %-13s %s: %s, %s\n", r.Decision, r.Input, r.Reason, kept)
+		default:
+			fmt.Printf("  %-13s %s: %s\n", r.Decision, r.Input, r.Reason)
+		}
+	}
+}
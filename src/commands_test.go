@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"video_compressor/src/ffmpeg"
+)
+
+// failingFFmpeg makes every FFmpeg and ffprobe run fail; the binaries are placeholders
+// in a temporary working directory
+func failingFFmpeg(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp := t.TempDir()
+	for _, name := range []string{"ffmpeg", "ffprobe"} {
+		if err := os.WriteFile(filepath.Join(tmp, name), nil, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chdir(tmp); err != nil {
+		t.Fatal(err)
+	}
+	original := ffmpeg.DefaultRunner
+	ffmpeg.DefaultRunner = &ffmpeg.FakeRunner{
+		Handler: func(inv ffmpeg.Invocation, stdout, stderr io.Writer) error {
+			return errors.New("exit status 1")
+		},
+	}
+	t.Cleanup(func() {
+		ffmpeg.DefaultRunner = original
+		os.Chdir(dir)
+	})
+}
+
+// videoDir returns a directory with two (invalid) videos
+func videoDir(t *testing.T) string {
+	dir := t.TempDir()
+	for _, name := range []string{"a.mp4", "b.mkv"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("not a video"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestBatchExitStatus(t *testing.T) {
+	failingFFmpeg(t)
+	input := videoDir(t)
+	output := filepath.Join(t.TempDir(), "out")
+
+	if got := runCompress([]string{"-input", input, "-output", output, "-jobs", "none", "-encoder", "cpu", "-quiet"}); got != exitError {
+		t.Errorf("compress with failing inputs exited %d, want %d", got, exitError)
+	}
+	if got := runEstimate([]string{"-input", input, "-encoder", "cpu"}); got != exitError {
+		t.Errorf("estimate with failing inputs exited %d, want %d", got, exitError)
+	}
+	if got := runCompress([]string{"-input", filepath.Join(input, "a.mp4"), "-output", output, "-jobs", "none", "-quiet"}); got != exitError {
+		t.Errorf("compress of a failing file exited %d, want %d", got, exitError)
+	}
+}
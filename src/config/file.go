@@ -0,0 +1,218 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultConfigFiles are looked up in the working directory, in order, when no config
+// file is given
+var DefaultConfigFiles = []string{"video_compressor.json", "video_compressor.yaml", "video_compressor.yml", "video_compressor.toml"}
+
+// FindDefaultFile returns the first of DefaultConfigFiles that exists, "" if none does
+func FindDefaultFile() string {
+	for _, name := range DefaultConfigFiles {
+		if _, err := os.Stat(name); err == nil {
+			return name
+		}
+	}
+	return ""
+}
+
+// Settings maps command line flag names (e.g. "cq", "output-extension") to values
+type Settings map[string]string
+
+// Profile is a named set of settings that may extend another profile
+type Profile struct {
+	Extends  string
+	Settings Settings
+}
+
+// File is a parsed configuration file. Top-level keys are settings applied before any
+// profile; "profiles" holds named profiles, each with an optional "extends" key:
+//
+//	{
+//	  "encoder": "cpu",
+//	  "profiles": {
+//	    "lectures": {"extends": "web", "sidecar-subtitles": true}
+//	  }
+//	}
+//
+// The same structure may be written in YAML (.yaml, .yml) or TOML (.toml).
+type File struct {
+	Path     string
+	Settings Settings
+	Profiles map[string]Profile
+}
+
+// LoadFile reads and parses a JSON, YAML or TOML configuration file; the format is
+// chosen by the file extension and defaults to JSON
+func LoadFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+	if data, err = toJSON(path, data); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+
+	f := &File{Path: path, Profiles: make(map[string]Profile)}
+	if profiles, ok := raw["profiles"]; ok {
+		delete(raw, "profiles")
+		var rawProfiles map[string]map[string]json.RawMessage
+		if err := json.Unmarshal(profiles, &rawProfiles); err != nil {
+			return nil, fmt.Errorf("failed to parse profiles in %s: %v", path, err)
+		}
+		for name, rawProfile := range rawProfiles {
+			var p Profile
+			if extends, ok := rawProfile["extends"]; ok {
+				delete(rawProfile, "extends")
+				if err := json.Unmarshal(extends, &p.Extends); err != nil {
+					return nil, fmt.Errorf("profile %s: extends must be a profile name", name)
+				}
+			}
+			if p.Settings, err = parseSettings(rawProfile); err != nil {
+				return nil, fmt.Errorf("profile %s: %v", name, err)
+			}
+			f.Profiles[name] = p
+		}
+	}
+	if f.Settings, err = parseSettings(raw); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return f, nil
+}
+
+// toJSON converts a YAML or TOML config file to JSON, so that all formats share the
+// JSON parsing; JSON files are returned unchanged
+func toJSON(path string, data []byte) ([]byte, error) {
+	var doc map[string]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+	case ".toml":
+		if err := toml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+	default:
+		return data, nil
+	}
+	if doc == nil {
+		// An empty YAML file
+		doc = map[string]any{}
+	}
+	return json.Marshal(doc)
+}
+
+// ParseSettings parses a JSON object of settings such as {"cq": 28, "encoder": "cpu"}
+func ParseSettings(data []byte) (Settings, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse settings: %v", err)
+	}
+	return parseSettings(raw)
+}
+
+// parseSettings converts JSON strings, numbers and booleans to flag values
+func parseSettings(raw map[string]json.RawMessage) (Settings, error) {
+	settings := make(Settings, len(raw))
+	for key, value := range raw {
+		value = bytes.TrimSpace(value)
+		switch {
+		case bytes.Equal(value, []byte("null")):
+			continue
+		case len(value) > 0 && value[0] == '"':
+			var s string
+			if err := json.Unmarshal(value, &s); err != nil {
+				return nil, fmt.Errorf("invalid value for %s: %v", key, err)
+			}
+			settings[key] = s
+		case len(value) > 0 && (value[0] == '[' || value[0] == '{'):
+			return nil, fmt.Errorf("invalid value for %s: expected a string, number or boolean", key)
+		default:
+			settings[key] = string(value)
+		}
+	}
+	return settings, nil
+}
+
+// ResolveSettings merges the top-level settings of f (which may be nil) with the
+// settings of the named profile and the profiles it extends, base profiles first.
+// Profiles in f take precedence over the built-in profiles of the same name.
+func ResolveSettings(f *File, profile string) (Settings, error) {
+	merged := make(Settings)
+	if f != nil {
+		for k, v := range f.Settings {
+			merged[k] = v
+		}
+	}
+	if profile == "" {
+		return merged, nil
+	}
+
+	// Walk up the inheritance chain, then apply it from the base down
+	var chain []Profile
+	seen := make(map[string]bool)
+	path := []string{}
+	for name := profile; name != ""; {
+		path = append(path, name)
+		if seen[name] {
+			return nil, fmt.Errorf("profile inheritance cycle: %s", strings.Join(path, " -> "))
+		}
+		seen[name] = true
+		p, ok := lookupProfile(f, name)
+		if !ok {
+			return nil, fmt.Errorf("unknown profile %q; available: %s", name, strings.Join(ProfileNames(f), ", "))
+		}
+		chain = append(chain, p)
+		name = p.Extends
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		for k, v := range chain[i].Settings {
+			merged[k] = v
+		}
+	}
+	return merged, nil
+}
+
+// lookupProfile finds a profile in f or among the built-in profiles
+func lookupProfile(f *File, name string) (Profile, bool) {
+	if f != nil {
+		if p, ok := f.Profiles[name]; ok {
+			return p, true
+		}
+	}
+	p, ok := BuiltinProfiles[name]
+	return p, ok
+}
+
+// ProfileNames returns the names of the built-in profiles and the profiles in f, sorted
+func ProfileNames(f *File) []string {
+	var names []string
+	for name := range BuiltinProfiles {
+		names = append(names, name)
+	}
+	if f != nil {
+		for name := range f.Profiles {
+			if _, ok := BuiltinProfiles[name]; !ok {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
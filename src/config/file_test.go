@@ -0,0 +1,89 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{
+		"encoder": "cpu",
+		"cq": 30,
+		"profiles": {
+			"lectures": {"extends": "phone", "sidecar-subtitles": true, "cq": 26},
+			"loop": {"extends": "loop"}
+		}
+	}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+
+	got, err := ResolveSettings(f, "lectures")
+	if err != nil {
+		t.Fatalf("ResolveSettings() error = %v", err)
+	}
+	// Top-level settings, then web, phone and lectures in inheritance order
+	want := Settings{
+		"encoder":           "cpu",
+		"cq":                "26",
+		"resolution":        "720p",
+		"max-fps":           "30",
+		"output-extension":  ".mp4",
+		"audio":             "first",
+		"loudnorm":          "true",
+		"loudness":          "-16",
+		"true-peak":         "-1.5",
+		"subtitles":         "drop",
+		"sidecar-subtitles": "true",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ResolveSettings() =\n%v\nwant\n%v", got, want)
+	}
+
+	if _, err := ResolveSettings(f, "loop"); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("ResolveSettings(loop) error = %v, want inheritance cycle", err)
+	}
+	if _, err := ResolveSettings(f, "missing"); err == nil {
+		t.Error("ResolveSettings(missing) succeeded, want error")
+	}
+}
+
+func TestLoadFileFormats(t *testing.T) {
+	files := map[string]string{
+		"config.json": `{"encoder": "cpu", "cq": 30, "loudness": -16.5, "profiles": {"lectures": {"extends": "web", "sidecar-subtitles": true}}}`,
+		"config.yaml": "encoder: cpu\ncq: 30\nloudness: -16.5\nprofiles:\n  lectures:\n    extends: web\n    sidecar-subtitles: true\n",
+		"config.toml": "encoder = \"cpu\"\ncq = 30\nloudness = -16.5\n\n[profiles.lectures]\nextends = \"web\"\nsidecar-subtitles = true\n",
+	}
+	wantSettings := Settings{"encoder": "cpu", "cq": "30", "loudness": "-16.5"}
+	wantProfile := Profile{Extends: "web", Settings: Settings{"sidecar-subtitles": "true"}}
+	for name, data := range files {
+		path := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		f, err := LoadFile(path)
+		if err != nil {
+			t.Errorf("LoadFile(%s) error = %v", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(f.Settings, wantSettings) || !reflect.DeepEqual(f.Profiles["lectures"], wantProfile) {
+			t.Errorf("LoadFile(%s) = %v %v, want %v %v", name, f.Settings, f.Profiles, wantSettings, wantProfile)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "broken.yaml")
+	if err := os.WriteFile(path, []byte("cq: [28"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFile(path); err == nil {
+		t.Error("LoadFile(broken.yaml) succeeded, want error")
+	}
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// FrameRateMode selects how the output frame rate is determined
+type FrameRateMode string
+
+const (
+	FrameRateSource FrameRateMode = "source" // Keep the frame rate of the input
+	FrameRateFixed  FrameRateMode = "fixed"  // Force a constant frame rate
+	FrameRateVFR    FrameRateMode = "vfr"    // Pass frame timestamps through unchanged (screen recordings)
+)
+
+// FrameRate is a frame rate setting with an exact rational rate for fixed rates
+type FrameRate struct {
+	Mode FrameRateMode
+	Num  int
+	Den  int
+}
+
+// ntscRates maps common decimal spellings to their exact NTSC rational rates
+var ntscRates = map[string]FrameRate{
+	"23.976": {Mode: FrameRateFixed, Num: 24000, Den: 1001},
+	"23.98":  {Mode: FrameRateFixed, Num: 24000, Den: 1001},
+	"29.97":  {Mode: FrameRateFixed, Num: 30000, Den: 1001},
+	"47.952": {Mode: FrameRateFixed, Num: 48000, Den: 1001},
+	"59.94":  {Mode: FrameRateFixed, Num: 60000, Den: 1001},
+	"119.88": {Mode: FrameRateFixed, Num: 120000, Den: 1001},
+}
+
+// ParseFrameRate converts a string to FrameRate.
+// Accepted values: "source", "vfr", integers ("30"), decimals ("29.97") and fractions ("30000/1001").
+func ParseFrameRate(s string) (FrameRate, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch s {
+	case "", "source":
+		return FrameRate{Mode: FrameRateSource}, nil
+	case "vfr", "passthrough":
+		return FrameRate{Mode: FrameRateVFR}, nil
+	}
+
+	if rate, ok := ntscRates[s]; ok {
+		return rate, nil
+	}
+
+	// Fraction, e.g. 30000/1001
+	if num, den, ok := strings.Cut(s, "/"); ok {
+		n, err1 := strconv.Atoi(num)
+		d, err2 := strconv.Atoi(den)
+		if err1 != nil || err2 != nil || n <= 0 || d <= 0 {
+			return FrameRate{}, fmt.Errorf("invalid frame rate: %s", s)
+		}
+		return newFixedFrameRate(n, d), nil
+	}
+
+	// Integer or decimal, e.g. 25 or 12.5
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f <= 0 || math.IsInf(f, 0) {
+		return FrameRate{}, fmt.Errorf("invalid frame rate: %s", s)
+	}
+	if f == math.Trunc(f) {
+		return newFixedFrameRate(int(f), 1), nil
+	}
+	// Other NTSC-style rates (n*1000/1001)
+	if n := math.Round(f * 1.001); math.Abs(f-n/1.001) < 0.005 {
+		return newFixedFrameRate(int(n)*1000, 1001), nil
+	}
+	return newFixedFrameRate(int(math.Round(f*1000)), 1000), nil
+}
+
+// newFixedFrameRate returns a fixed frame rate with the fraction reduced
+func newFixedFrameRate(num, den int) FrameRate {
+	a, b := num, den
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return FrameRate{Mode: FrameRateFixed, Num: num / a, Den: den / a}
+}
+
+// IsSet reports whether a fixed rate is configured
+func (f FrameRate) IsSet() bool {
+	return f.Mode == FrameRateFixed && f.Num > 0 && f.Den > 0
+}
+
+// Float returns the frame rate in frames per second (0 if no fixed rate is set)
+func (f FrameRate) Float() float64 {
+	if !f.IsSet() {
+		return 0
+	}
+	return float64(f.Num) / float64(f.Den)
+}
+
+// String returns the frame rate in the form accepted by FFmpeg and ParseFrameRate
+func (f FrameRate) String() string {
+	switch {
+	case f.IsSet() && f.Den == 1:
+		return strconv.Itoa(f.Num)
+	case f.IsSet():
+		return fmt.Sprintf("%d/%d", f.Num, f.Den)
+	case f.Mode == FrameRateVFR:
+		return string(FrameRateVFR)
+	default:
+		return string(FrameRateSource)
+	}
+}
@@ -0,0 +1,48 @@
+package config
+
+import "testing"
+
+func TestParseFrameRate(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    FrameRate
+		wantErr bool
+	}{
+		{"30000/1001", FrameRate{Mode: FrameRateFixed, Num: 30000, Den: 1001}, false},
+		{"50/2", FrameRate{Mode: FrameRateFixed, Num: 25, Den: 1}, false},
+		{"25", FrameRate{Mode: FrameRateFixed, Num: 25, Den: 1}, false},
+		{"29.97", FrameRate{Mode: FrameRateFixed, Num: 30000, Den: 1001}, false},
+		{"12.5", FrameRate{Mode: FrameRateFixed, Num: 25, Den: 2}, false},
+		{" VFR ", FrameRate{Mode: FrameRateVFR}, false},
+		{"", FrameRate{Mode: FrameRateSource}, false},
+		{"source", FrameRate{Mode: FrameRateSource}, false},
+		{"0/0", FrameRate{}, true},
+		{"30/0", FrameRate{}, true},
+		{"0", FrameRate{}, true},
+		{"-25", FrameRate{}, true},
+		{"fast", FrameRate{}, true},
+		{"30/x", FrameRate{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseFrameRate(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseFrameRate(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseFrameRate(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFrameRateString(t *testing.T) {
+	for _, in := range []string{"30000/1001", "25", "vfr", "source"} {
+		rate, err := ParseFrameRate(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := rate.String(); got != in {
+			t.Errorf("ParseFrameRate(%q).String() = %q", in, got)
+		}
+	}
+}
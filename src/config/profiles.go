@@ -0,0 +1,43 @@
+package config
+
+// BuiltinProfiles are the named profiles available without a configuration file
+var BuiltinProfiles = map[string]Profile{
+	// Streaming and embedding on web pages
+	"web": {Settings: Settings{
+		"resolution":       "1080p",
+		"cq":               "28",
+		"max-fps":          "30",
+		"output-extension": ".mp4",
+		"audio":            "first",
+		"loudnorm":         "true",
+		"loudness":         "-16",
+		"true-peak":        "-1.5",
+	}},
+	// Long-term storage: high quality, every stream and all metadata kept
+	"archive": {Settings: Settings{
+		"resolution":       "4k",
+		"cq":               "20",
+		"preset":           "p7",
+		"output-extension": ".mkv",
+		"hdr":              "preserve",
+		"audio":            "all",
+		"subtitles":        "copy",
+		"metadata":         "true",
+	}},
+	// Messaging apps with a 25 MB upload limit: small 720p files for short clips. The size
+	// is not enforced; longer videos need a higher cq or a lower resolution to fit.
+	"chat-25mb": {Settings: Settings{
+		"resolution":       "720p",
+		"cq":               "32",
+		"max-fps":          "30",
+		"output-extension": ".mp4",
+		"audio":            "first",
+		"subtitles":        "drop",
+	}},
+	// Playback on phones
+	"phone": {Extends: "web", Settings: Settings{
+		"resolution": "720p",
+		"cq":         "30",
+		"subtitles":  "drop",
+	}},
+}
@@ -64,19 +64,297 @@ func StringToResolution(s interface{}) (Resolution, error) {
 	return "", fmt.Errorf("unsupported resolution: %v", s)
 }
 
+// ScalePolicy controls how target dimensions relate to the source dimensions
+type ScalePolicy string
+
+const (
+	ScaleNeverUpscale ScalePolicy = "never" // Cap target dimensions at the source dimensions
+	ScaleAllowUpscale ScalePolicy = "allow" // Scale to the target resolution even if it is larger than the source
+	ScaleFitBox       ScalePolicy = "fit"   // Fit inside the target resolution box without upscaling
+)
+
+// StringToScalePolicy converts a string to ScalePolicy type
+func StringToScalePolicy(s string) (ScalePolicy, error) {
+	switch strings.ToLower(s) {
+	case "", "never":
+		return ScaleNeverUpscale, nil
+	case "allow":
+		return ScaleAllowUpscale, nil
+	case "fit":
+		return ScaleFitBox, nil
+	}
+	return "", fmt.Errorf("unsupported scale policy: %s", s)
+}
+
+// HDRMode controls how HDR (HDR10/HLG) sources are encoded
+type HDRMode string
+
+const (
+	HDRToneMap  HDRMode = "tonemap"  // Tone map HDR sources to 8-bit SDR BT.709
+	HDRPreserve HDRMode = "preserve" // Keep HDR with 10-bit HEVC/AV1 and HDR color metadata
+	HDROff      HDRMode = "off"      // Do not treat HDR sources specially
+)
+
+// StringToHDRMode converts a string to HDRMode type
+func StringToHDRMode(s string) (HDRMode, error) {
+	switch strings.ToLower(s) {
+	case "", "tonemap":
+		return HDRToneMap, nil
+	case "preserve":
+		return HDRPreserve, nil
+	case "off":
+		return HDROff, nil
+	}
+	return "", fmt.Errorf("unsupported HDR mode: %s", s)
+}
+
+// ToneMapOperators lists the operators supported by FFmpeg's tonemap filter
+var ToneMapOperators = map[string]bool{
+	"hable":    true,
+	"mobius":   true,
+	"reinhard": true,
+	"clip":     true,
+	"linear":   true,
+	"gamma":    true,
+}
+
+// DeinterlaceMode controls deinterlacing of interlaced sources
+type DeinterlaceMode string
+
+const (
+	DeinterlaceAuto DeinterlaceMode = "auto" // Deinterlace when idet detects interlaced frames
+	DeinterlaceOn   DeinterlaceMode = "on"   // Always deinterlace
+	DeinterlaceOff  DeinterlaceMode = "off"  // Never deinterlace
+)
+
+// StringToDeinterlaceMode converts a string to DeinterlaceMode type
+func StringToDeinterlaceMode(s string) (DeinterlaceMode, error) {
+	switch strings.ToLower(s) {
+	case "", "auto":
+		return DeinterlaceAuto, nil
+	case "on":
+		return DeinterlaceOn, nil
+	case "off":
+		return DeinterlaceOff, nil
+	}
+	return "", fmt.Errorf("unsupported deinterlace mode: %s", s)
+}
+
+// DeinterlaceFilters lists the supported deinterlacing filters
+var DeinterlaceFilters = map[string]bool{
+	"bwdif": true,
+	"yadif": true,
+}
+
+// DenoiseStrengths lists the supported denoise strengths ("off" disables denoising)
+var DenoiseStrengths = map[string]bool{
+	"off":    true,
+	"light":  true,
+	"medium": true,
+	"strong": true,
+}
+
+// DenoiseFilters lists the supported denoising filters
+var DenoiseFilters = map[string]bool{
+	"hqdn3d":  true,
+	"nlmeans": true,
+}
+
+// OverwritePolicy controls what happens when the output file already exists
+type OverwritePolicy string
+
+const (
+	OverwriteNever     OverwritePolicy = "never"      // Fail instead of replacing an existing output
+	OverwriteAlways    OverwritePolicy = "always"     // Replace an existing output
+	OverwriteIfSmaller OverwritePolicy = "if-smaller" // Replace an existing output only if the new one is smaller
+)
+
+// StringToOverwritePolicy converts a string to OverwritePolicy type
+func StringToOverwritePolicy(s string) (OverwritePolicy, error) {
+	switch strings.ToLower(s) {
+	case "", "never":
+		return OverwriteNever, nil
+	case "always":
+		return OverwriteAlways, nil
+	case "if-smaller":
+		return OverwriteIfSmaller, nil
+	}
+	return "", fmt.Errorf("unsupported overwrite policy: %s", s)
+}
+
+// SkipAction controls what is left at the output path when an input is skipped or its output discarded
+type SkipAction string
+
+const (
+	SkipKeepOriginal SkipAction = "keep" // Write nothing, the original stays where it is
+	SkipCopyOriginal SkipAction = "copy" // Copy the original to the output location
+)
+
+// StringToSkipAction converts a string to SkipAction type
+func StringToSkipAction(s string) (SkipAction, error) {
+	switch strings.ToLower(s) {
+	case "", "keep":
+		return SkipKeepOriginal, nil
+	case "copy":
+		return SkipCopyOriginal, nil
+	}
+	return "", fmt.Errorf("unsupported skip action: %s", s)
+}
+
+// AudioSelection selects which audio streams are kept
+type AudioSelection string
+
+const (
+	AudioAll      AudioSelection = "all"      // Keep every audio stream
+	AudioFirst    AudioSelection = "first"    // Keep the first audio stream only
+	AudioLanguage AudioSelection = "language" // Keep the audio streams in AudioLanguages
+)
+
+// StringToAudioSelection converts a string to AudioSelection type
+func StringToAudioSelection(s string) (AudioSelection, error) {
+	switch strings.ToLower(s) {
+	case "", "all":
+		return AudioAll, nil
+	case "first":
+		return AudioFirst, nil
+	case "language", "lang":
+		return AudioLanguage, nil
+	}
+	return "", fmt.Errorf("unsupported audio selection: %s", s)
+}
+
+// OverlayPosition is the corner (or center) an overlay is placed in
+type OverlayPosition string
+
+const (
+	PositionTopLeft     OverlayPosition = "top-left"
+	PositionTopRight    OverlayPosition = "top-right"
+	PositionBottomLeft  OverlayPosition = "bottom-left"
+	PositionBottomRight OverlayPosition = "bottom-right"
+	PositionCenter      OverlayPosition = "center"
+)
+
+// StringToOverlayPosition converts a string to OverlayPosition type
+func StringToOverlayPosition(s string) (OverlayPosition, error) {
+	switch p := OverlayPosition(strings.ToLower(s)); p {
+	case PositionTopLeft, PositionTopRight, PositionBottomLeft, PositionBottomRight, PositionCenter:
+		return p, nil
+	}
+	return "", fmt.Errorf("unsupported overlay position: %s", s)
+}
+
+// OverlayScope selects where overlays are applied when merging
+type OverlayScope string
+
+const (
+	OverlayOutput  OverlayScope = "output"  // Once over the merged output
+	OverlaySegment OverlayScope = "segment" // On every segment, e.g. to caption each clip with its file name
+)
+
+// StringToOverlayScope converts a string to OverlayScope type
+func StringToOverlayScope(s string) (OverlayScope, error) {
+	switch strings.ToLower(s) {
+	case "", "output":
+		return OverlayOutput, nil
+	case "segment":
+		return OverlaySegment, nil
+	}
+	return "", fmt.Errorf("unsupported overlay scope: %s", s)
+}
+
+// SubtitleMode controls how embedded subtitle streams are handled
+type SubtitleMode string
+
+const (
+	SubtitlesCopy SubtitleMode = "copy" // Copy, converting text subtitles to a format the container supports
+	SubtitlesDrop SubtitleMode = "drop" // Remove all subtitle streams
+)
+
+// StringToSubtitleMode converts a string to SubtitleMode type
+func StringToSubtitleMode(s string) (SubtitleMode, error) {
+	switch strings.ToLower(s) {
+	case "", "copy":
+		return SubtitlesCopy, nil
+	case "drop":
+		return SubtitlesDrop, nil
+	}
+	return "", fmt.Errorf("unsupported subtitle mode: %s", s)
+}
+
 // VideoConfig holds all video compression parameters
 type VideoConfig struct {
 	FfmpegPath      string
-	Fps             int
+	Fps             FrameRate // Output frame rate ("source" keeps the input rate)
+	MaxFps          FrameRate // Cap applied only when the output rate would be higher (unset means no cap)
 	Resolution      Resolution
 	Bitrate         int
 	Preset          string
 	Cq              int
-	Width           int    // Target width (0 means auto). If set, Resolution will be ignored
-	Height          int    // Target height (0 means auto). If set, Resolution will be ignored
-	Encoder         string // "gpu" for NVIDIA HEVC or "cpu" for libx265
-	OutputExtension string // ".mp4", ".mkv", ".avi", ".mov", ".wmv", ".flv"
+	Width           int             // Target width (0 means auto). If set, Resolution will be ignored
+	Height          int             // Target height (0 means auto). If set, Resolution will be ignored
+	Encoder         string          // "gpu" for NVIDIA HEVC or "cpu" for libx265
+	OutputExtension string          // ".mp4", ".mkv", ".avi", ".mov", ".wmv", ".flv"
+	AutoCrop        bool            // Detect and remove black borders with cropdetect before scaling
+	Overwrite       OverwritePolicy // "never" (default), "always" or "if-smaller"
+
+	// Scaling limits applied to resolution-based targets
+	ScalePolicy ScalePolicy // "never" (default), "allow" or "fit"
+	MaxWidth    int         // Upper bound for the target width (0 means unbounded)
+	MaxHeight   int         // Upper bound for the target height (0 means unbounded)
+
+	// HDR handling
+	HDRMode         HDRMode // "tonemap" (default), "preserve" or "off"
+	ToneMapOperator string  // tonemap operator: hable, mobius, reinhard, clip, linear, gamma
+
+	// Restoration filters
+	Deinterlace       DeinterlaceMode // "auto" (default), "on" or "off"
+	DeinterlaceFilter string          // "bwdif" (default) or "yadif"
+	Denoise           string          // "off" (default), "light", "medium" or "strong"
+	DenoiseFilter     string          // "hqdn3d" (default) or "nlmeans"
+
+	// Re-encode safeguards
+	SkipBelowBpp     float64    // Skip inputs below this many bits per pixel (0 disables)
+	SkipTargetCodec  bool       // Skip inputs already in the target codec at or under the target resolution
+	MinSavingPercent float64    // Discard outputs that save less than this percentage of the input size
+	KeepAllOutputs   bool       // Never discard an output for its saving, e.g. the segments of a merge
+	SkipAction       SkipAction // "keep" (default) or "copy" the original when skipping or discarding
+
+	// Stream selection
+	Audio          AudioSelection // "all" (default), "first" or "language"
+	AudioLanguages []string       // ISO 639-2 codes kept with AudioLanguage, e.g. "eng", "jpn"
+	Subtitles      SubtitleMode   // "copy" (default) or "drop"
+
+	// Subtitle burn-in and sidecar files
+	BurnSubtitles     string // Subtitle file (.srt, .ass, ...) burned into the picture
+	BurnSubtitleTrack int    // Embedded subtitle track burned into the picture, starting at 1 (0 disables)
+	FontsDir          string // Extra font directory for burned subtitles
+	SidecarSubtitles  bool   // Mux name.*.srt files next to the input as subtitle tracks
+
+	// Watermark and text overlays, applied after scaling
+	Watermark         string          // Image file overlaid on the video ("" for none)
+	WatermarkPosition OverlayPosition // Corner or center of the watermark
+	WatermarkMargin   int             // Distance from the edges in pixels
+	WatermarkScale    float64         // Watermark width relative to the output width (0 keeps the image size)
+	WatermarkOpacity  float64         // 0 (invisible) to 1 (opaque)
+	Text              string          // drawtext template with {filename}, {date} and {timecode} ("" for none)
+	TextPosition      OverlayPosition // Corner or center of the text
+	TextSize          int             // Font size in pixels
+	TextFontFile      string          // Font file for the text (fontconfig default if empty)
+	OverlayScope      OverlayScope    // "output" (default) or "segment" when merging
+
+	// Loudness normalization (EBU R128, two-pass loudnorm)
+	Loudnorm       bool    // Normalize the loudness of every audio stream
+	LoudnessTarget float64 // Integrated loudness target in LUFS, e.g. -23
+	TruePeak       float64 // Maximum true peak in dBTP, e.g. -1
+	LoudnessRange  float64 // Loudness range target in LU, e.g. 7
+
+	// Metadata preservation
+	PreserveMetadata bool // Copy global and stream metadata, file timestamps and creation time
+	CopyXattrs       bool // Copy extended file attributes (Linux only)
 
 	// Reverse the order of the files to be merged
 	Reverse bool
+
+	// Analyze the inputs and print the FFmpeg commands without encoding anything
+	DryRun bool
 }
@@ -0,0 +1,133 @@
+package ffmpeg
+
+import (
+	"strings"
+
+	"video_compressor/src/filtergraph"
+)
+
+// Input is an input file with the options that apply to it (placed before -i)
+type Input struct {
+	Path    string
+	Options []string
+}
+
+// Output is an output file with its stream selection, codecs, filters and options
+type Output struct {
+	Path         string
+	Maps         []string           // Stream specifiers passed to -map
+	Codecs       []string           // Codec args, e.g. from DetermineCodec
+	VideoFilters *filtergraph.Chain // Rendered as -vf
+	AudioFilters *filtergraph.Chain // Rendered as -af
+	Options      []string           // Any other output options
+	Format       string             // Muxer name passed to -f
+}
+
+// Command is an FFmpeg or ffprobe invocation
+type Command struct {
+	Binary      string
+	Global      []string
+	Inputs      []Input
+	FilterGraph *filtergraph.Graph // Rendered as -filter_complex
+	Outputs     []*Output
+}
+
+// NewCommand creates a command for the given binary with global options
+func NewCommand(binary string, global ...string) *Command {
+	return &Command{Binary: binary, Global: global}
+}
+
+// AddInput appends an input file with its per-input options
+func (c *Command) AddInput(path string, options ...string) *Command {
+	c.Inputs = append(c.Inputs, Input{Path: path, Options: options})
+	return c
+}
+
+// AddOutput appends an output file and returns it for further configuration
+func (c *Command) AddOutput(path string) *Output {
+	o := &Output{Path: path}
+	c.Outputs = append(c.Outputs, o)
+	return o
+}
+
+// Map adds stream specifiers to the output
+func (o *Output) Map(specs ...string) *Output {
+	o.Maps = append(o.Maps, specs...)
+	return o
+}
+
+// Codec adds codec args to the output
+func (o *Output) Codec(args ...string) *Output {
+	o.Codecs = append(o.Codecs, args...)
+	return o
+}
+
+// Option adds other args to the output
+func (o *Output) Option(args ...string) *Output {
+	o.Options = append(o.Options, args...)
+	return o
+}
+
+// Args returns the argument list in FFmpeg order: global options, inputs,
+// the complex filtergraph, then each output with its options
+func (c *Command) Args() []string {
+	args := append([]string{}, c.Global...)
+	for _, in := range c.Inputs {
+		args = append(args, in.Options...)
+		args = append(args, "-i", in.Path)
+	}
+	if c.FilterGraph != nil && !c.FilterGraph.Empty() {
+		args = append(args, "-filter_complex", c.FilterGraph.String())
+	}
+	for _, o := range c.Outputs {
+		for _, m := range o.Maps {
+			args = append(args, "-map", m)
+		}
+		args = append(args, o.Codecs...)
+		if !o.VideoFilters.Empty() {
+			args = append(args, "-vf", o.VideoFilters.String())
+		}
+		if !o.AudioFilters.Empty() {
+			args = append(args, "-af", o.AudioFilters.String())
+		}
+		args = append(args, o.Options...)
+		if o.Format != "" {
+			args = append(args, "-f", o.Format)
+		}
+		args = append(args, o.Path)
+	}
+	return args
+}
+
+// String returns the command line with arguments separated by spaces
+func (c *Command) String() string {
+	return strings.Join(append([]string{c.Binary}, c.Args()...), " ")
+}
+
+// ShellString returns the command line quoted for a POSIX shell, so that it can be
+// copied into a terminal as is
+func (c *Command) ShellString() string {
+	args := append([]string{c.Binary}, c.Args()...)
+	for i, arg := range args {
+		args[i] = ShellQuote(arg)
+	}
+	return strings.Join(args, " ")
+}
+
+// ShellQuote quotes s for a POSIX shell if it contains characters the shell interprets
+func ShellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	safe := true
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:=,+@%", r)) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,99 @@
+package ffmpeg
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"video_compressor/src/filtergraph"
+)
+
+func TestCommandArgsOrder(t *testing.T) {
+	cmd := NewCommand("ffmpeg", "-y", "-hide_banner").
+		AddInput("in.mp4", "-ss", "10").
+		AddInput("logo.png")
+	cmd.FilterGraph = &filtergraph.Graph{}
+	cmd.FilterGraph.Add(filtergraph.NewChain("0:v", "1:v").Append(filtergraph.New("overlay", 10, 10)).To("v"))
+	out := cmd.AddOutput("out.mkv").Map("[v]", "0:a?").Codec("-c:v", "libx265").Option("-r", "30")
+	out.AudioFilters = filtergraph.NewChain().Append(filtergraph.New("volume", 2))
+	out.Format = "matroska"
+
+	want := []string{
+		"-y", "-hide_banner",
+		"-ss", "10", "-i", "in.mp4",
+		"-i", "logo.png",
+		"-filter_complex", "[0:v][1:v]overlay=10:10[v]",
+		"-map", "[v]", "-map", "0:a?",
+		"-c:v", "libx265",
+		"-af", "volume=2",
+		"-r", "30",
+		"-f", "matroska",
+		"out.mkv",
+	}
+	if got := cmd.Args(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Args() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestCommandArgsSkipsEmptyFilters(t *testing.T) {
+	cmd := NewCommand("ffmpeg").AddInput("in.mp4")
+	out := cmd.AddOutput("-")
+	out.VideoFilters = filtergraph.NewChain()
+	out.Format = "null"
+
+	want := []string{"-i", "in.mp4", "-f", "null", "-"}
+	if got := cmd.Args(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Args() = %q, want %q", got, want)
+	}
+}
+
+func TestFakeRunnerRecordsInvocations(t *testing.T) {
+	fake := &FakeRunner{
+		Handler: func(inv Invocation, stdout, stderr io.Writer) error {
+			if inv.Binary == "ffprobe" {
+				io.WriteString(stdout, "1920,1080\n")
+				return nil
+			}
+			io.WriteString(stderr, "boom")
+			return errors.New("exit status 1")
+		},
+	}
+
+	probe := NewCommand("ffprobe", "-v", "error").AddInput("in.mp4")
+	output, err := RunOutput(context.Background(), fake, probe)
+	if err != nil || string(output) != "1920,1080\n" {
+		t.Fatalf("RunOutput() = %q, %v", output, err)
+	}
+
+	encode := NewCommand("ffmpeg").AddInput("in.mp4")
+	encode.AddOutput("out.mp4")
+	output, err = RunCombinedOutput(context.Background(), fake, encode)
+	if err == nil || string(output) != "boom" {
+		t.Fatalf("RunCombinedOutput() = %q, %v", output, err)
+	}
+
+	want := []Invocation{
+		{Binary: "ffprobe", Args: []string{"-v", "error", "-i", "in.mp4"}},
+		{Binary: "ffmpeg", Args: []string{"-i", "in.mp4", "out.mp4"}},
+	}
+	if got := fake.Calls(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Calls() = %q, want %q", got, want)
+	}
+}
+
+func TestCommandShellString(t *testing.T) {
+	cmd := NewCommand("ffmpeg", "-y").AddInput("my video's.mp4")
+	out := cmd.AddOutput("out dir/out.mp4")
+	out.VideoFilters = filtergraph.NewChain().Append(filtergraph.New("scale", 1280, 720))
+	out.Option("-metadata", "title=", "-filter:a:0", "loudnorm=I=-16:TP=-1.5")
+
+	want := `ffmpeg -y -i 'my video'\''s.mp4' -vf scale=1280:720 -metadata title= -filter:a:0 loudnorm=I=-16:TP=-1.5 'out dir/out.mp4'`
+	if got := cmd.ShellString(); got != want {
+		t.Errorf("ShellString() =\n%s\nwant\n%s", got, want)
+	}
+	if got := ShellQuote(""); got != "''" {
+		t.Errorf("ShellQuote(\"\") = %s, want ''", got)
+	}
+}
@@ -2,6 +2,7 @@ package ffmpeg
 
 import (
 	"archive/zip"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -13,6 +14,7 @@ import (
 	"strings"
 
 	"video_compressor/src/config"
+	"video_compressor/src/filtergraph"
 )
 
 // Supported video formats
@@ -35,6 +37,15 @@ var GpuSupportedExt = map[string]bool{
 	".ts":  true,
 }
 
+// HDRSupportedExt lists container formats that can carry 10-bit HDR video.
+var HDRSupportedExt = map[string]bool{
+	".mp4":  true,
+	".mov":  true,
+	".mkv":  true,
+	".ts":   true,
+	".webm": true,
+}
+
 // SupportedFormatsKeys returns a slice of the keys of a map
 func SupportedFormatsKeys() []string {
 	k := make([]string, 0, len(SupportedFormats))
@@ -44,16 +55,40 @@ func SupportedFormatsKeys() []string {
 	return k
 }
 
-// DetermineCodec returns the codec-related FFmpeg args based on output extension.
-func DetermineCodec(ext string, cfg config.VideoConfig) []string {
-	// If GPU is requested but the container does not support HEVC_NVENC, fall back to CPU HEVC
-	if cfg.Encoder == "gpu" && !GpuSupportedExt[ext] {
+// NVENCPresets are the hevc_nvenc presets from fastest to best quality
+var NVENCPresets = []string{"p1", "p2", "p3", "p4", "p5", "p6", "p7"}
+
+// CPUPresets are the libx264/libx265 presets from fastest to best quality
+var CPUPresets = []string{"ultrafast", "superfast", "veryfast", "faster", "fast", "medium", "slow", "slower", "veryslow"}
+
+// CPUPreset translates an NVENC preset (p1-p7) to the libx264/libx265 preset of similar
+// speed, so that one preset setting works for both encoders. Other values are kept.
+func CPUPreset(preset string) string {
+	for i, p := range NVENCPresets {
+		if p == preset {
+			return CPUPresets[i]
+		}
+	}
+	return preset
+}
+
+// ResolveEncoder returns the encoder ("gpu" or "cpu") used for the output extension.
+// If GPU is requested but the container does not support HEVC_NVENC, it warns and
+// falls back to CPU.
+func ResolveEncoder(ext, encoder string) string {
+	if encoder == "gpu" && !GpuSupportedExt[ext] {
 		fmt.Printf(
 			"Warning: GPU encoding (hevc_nvenc) is not supported for %s, falling back to CPU libx265.\n",
 			ext,
 		)
-		cfg.Encoder = "cpu"
+		return "cpu"
 	}
+	return encoder
+}
+
+// DetermineCodec returns the codec-related FFmpeg args based on output extension.
+func DetermineCodec(ext string, cfg config.VideoConfig) []string {
+	cfg.Encoder = ResolveEncoder(ext, cfg.Encoder)
 
 	if cfg.Encoder == "gpu" {
 		// hevc_nvenc: supports -rc, -cq, -b:v, -maxrate, -bufsize
@@ -72,7 +107,7 @@ func DetermineCodec(ext string, cfg config.VideoConfig) []string {
 		// libx264: supports -preset, -crf, -b:v, -maxrate, -bufsize
 		return []string{
 			"-c:v", "libx264",
-			"-preset", cfg.Preset,
+			"-preset", CPUPreset(cfg.Preset),
 			"-crf", strconv.Itoa(cfg.Cq),
 			"-b:v", fmt.Sprintf("%dk", cfg.Bitrate),
 			"-maxrate", fmt.Sprintf("%dk", cfg.Bitrate),
@@ -83,7 +118,7 @@ func DetermineCodec(ext string, cfg config.VideoConfig) []string {
 		// libx265: supports -preset, -crf, -b:v, -maxrate, -bufsize
 		return []string{
 			"-c:v", "libx265",
-			"-preset", cfg.Preset,
+			"-preset", CPUPreset(cfg.Preset),
 			"-crf", strconv.Itoa(cfg.Cq),
 			"-b:v", fmt.Sprintf("%dk", cfg.Bitrate),
 			"-maxrate", fmt.Sprintf("%dk", cfg.Bitrate),
@@ -109,7 +144,7 @@ func DetermineCodec(ext string, cfg config.VideoConfig) []string {
 		// fallback to libx264
 		return []string{
 			"-c:v", "libx264",
-			"-preset", cfg.Preset,
+			"-preset", CPUPreset(cfg.Preset),
 			"-crf", strconv.Itoa(cfg.Cq),
 			"-b:v", fmt.Sprintf("%dk", cfg.Bitrate),
 			"-maxrate", fmt.Sprintf("%dk", cfg.Bitrate),
@@ -118,12 +153,328 @@ func DetermineCodec(ext string, cfg config.VideoConfig) []string {
 	}
 }
 
+// DetermineHDRCodec returns codec args that keep HDR video as 10-bit HEVC (AV1 for WebM)
+// with HDR color metadata. transfer is the probed color transfer of the source.
+func DetermineHDRCodec(ext string, cfg config.VideoConfig, transfer string) []string {
+	colorArgs := []string{
+		"-color_primaries", "bt2020",
+		"-color_trc", transfer,
+		"-colorspace", "bt2020nc",
+	}
+
+	var args []string
+	switch {
+	case ext == ".webm":
+		// libsvtav1: supports -preset (0-13), -crf, -b:v
+		args = []string{
+			"-c:v", "libsvtav1",
+			"-pix_fmt", "yuv420p10le",
+			"-crf", strconv.Itoa(cfg.Cq),
+			"-b:v", fmt.Sprintf("%dk", cfg.Bitrate),
+		}
+
+	case cfg.Encoder == "gpu" && GpuSupportedExt[ext]:
+		// hevc_nvenc: main10 profile with 10-bit input
+		args = []string{
+			"-c:v", "hevc_nvenc",
+			"-profile:v", "main10",
+			"-pix_fmt", "p010le",
+			"-rc", "vbr",
+			"-cq", strconv.Itoa(cfg.Cq),
+			"-b:v", fmt.Sprintf("%dk", cfg.Bitrate),
+			"-maxrate", fmt.Sprintf("%dk", cfg.Bitrate),
+			"-bufsize", fmt.Sprintf("%dk", cfg.Bitrate*2),
+		}
+
+	default:
+		// libx265: 10-bit with HDR signalling repeated in every keyframe
+		args = []string{
+			"-c:v", "libx265",
+			"-preset", CPUPreset(cfg.Preset),
+			"-pix_fmt", "yuv420p10le",
+			"-crf", strconv.Itoa(cfg.Cq),
+			"-b:v", fmt.Sprintf("%dk", cfg.Bitrate),
+			"-maxrate", fmt.Sprintf("%dk", cfg.Bitrate),
+			"-bufsize", fmt.Sprintf("%dk", cfg.Bitrate*2),
+			"-x265-params", fmt.Sprintf(
+				"hdr-opt=1:repeat-headers=1:colorprim=bt2020:transfer=%s:colormatrix=bt2020nc",
+				transfer,
+			),
+		}
+	}
+
+	// MP4/MOV players expect the hvc1 tag for HEVC
+	if ext == ".mp4" || ext == ".mov" {
+		args = append(args, "-tag:v", "hvc1")
+	}
+	return append(args, colorArgs...)
+}
+
+// ToneMapFilters returns the filters that convert HDR video to 8-bit SDR BT.709.
+func ToneMapFilters(operator string) []filtergraph.Filter {
+	if operator == "" {
+		operator = "hable"
+	}
+	return []filtergraph.Filter{
+		filtergraph.New("zscale").With("t", "linear").With("npl", 100),
+		filtergraph.New("format", "gbrpf32le"),
+		filtergraph.New("zscale").With("p", "bt709"),
+		filtergraph.New("tonemap").With("tonemap", operator).With("desat", 0),
+		filtergraph.New("zscale").With("t", "bt709").With("m", "bt709").With("r", "tv"),
+		filtergraph.New("format", "yuv420p"),
+	}
+}
+
+// DeinterlaceFilter returns the deinterlacing filter outputting one frame per frame.
+func DeinterlaceFilter(name string) filtergraph.Filter {
+	if name != "yadif" {
+		name = "bwdif"
+	}
+	return filtergraph.New(name).With("mode", "send_frame").With("parity", "auto").With("deint", "all")
+}
+
+// DenoiseFilter returns the denoising filter for the given strength (false if denoising is off).
+func DenoiseFilter(name, strength string) (filtergraph.Filter, bool) {
+	if name == "nlmeans" {
+		switch strength {
+		case "light":
+			return filtergraph.New("nlmeans").With("s", 1.5), true
+		case "medium":
+			return filtergraph.New("nlmeans").With("s", 3), true
+		case "strong":
+			return filtergraph.New("nlmeans").With("s", 6), true
+		}
+		return filtergraph.Filter{}, false
+	}
+
+	// hqdn3d: luma_spatial:chroma_spatial:luma_tmp:chroma_tmp
+	switch strength {
+	case "light":
+		return filtergraph.New("hqdn3d", 2, 1.5, 3, 2.25), true
+	case "medium":
+		return filtergraph.New("hqdn3d", 4, 3, 6, 4.5), true
+	case "strong":
+		return filtergraph.New("hqdn3d", 8, 6, 12, 9), true
+	}
+	return filtergraph.Filter{}, false
+}
+
+// SubtitlesFilter returns the filter that burns subtitles into the picture.
+// streamIndex selects an embedded subtitle stream of path (-1 for a subtitle file);
+// ASS/SSA files use the ass filter, which keeps their styling. fontsDir may be empty.
+func SubtitlesFilter(path string, streamIndex int, fontsDir string) filtergraph.Filter {
+	ext := strings.ToLower(filepath.Ext(path))
+	var f filtergraph.Filter
+	if streamIndex < 0 && (ext == ".ass" || ext == ".ssa") {
+		f = filtergraph.New("ass").With("filename", path)
+	} else {
+		f = filtergraph.New("subtitles").With("filename", path)
+		if streamIndex >= 0 {
+			f = f.With("si", streamIndex)
+		}
+	}
+	if fontsDir != "" {
+		f = f.With("fontsdir", fontsDir)
+	}
+	return f
+}
+
+// positionExprs returns the x and y expressions that place an object of size objW x objH
+// inside a frame of size frameW x frameH (expression variable names) at pos
+func positionExprs(pos config.OverlayPosition, margin int, frameW, frameH, objW, objH string) (string, string) {
+	m := strconv.Itoa(margin)
+	x, y := m, m
+	switch pos {
+	case config.PositionTopRight:
+		x = frameW + "-" + objW + "-" + m
+	case config.PositionBottomLeft:
+		y = frameH + "-" + objH + "-" + m
+	case config.PositionBottomRight:
+		x = frameW + "-" + objW + "-" + m
+		y = frameH + "-" + objH + "-" + m
+	case config.PositionCenter:
+		x = "(" + frameW + "-" + objW + ")/2"
+		y = "(" + frameH + "-" + objH + ")/2"
+	}
+	return x, y
+}
+
+// WatermarkFilters returns the filters that prepare a watermark image: scaled to width
+// (0 keeps the image size) and made translucent if opacity is below 1
+func WatermarkFilters(width int, opacity float64) []filtergraph.Filter {
+	var filters []filtergraph.Filter
+	if width > 0 {
+		filters = append(filters, filtergraph.New("scale", width, -1))
+	}
+	filters = append(filters, filtergraph.New("format", "rgba"))
+	if opacity < 1 {
+		filters = append(filters, filtergraph.New("colorchannelmixer").With("aa", strconv.FormatFloat(opacity, 'f', -1, 64)))
+	}
+	return filters
+}
+
+// OverlayFilter returns the overlay filter placing its second input at pos
+func OverlayFilter(pos config.OverlayPosition, margin int) filtergraph.Filter {
+	x, y := positionExprs(pos, margin, "W", "H", "w", "h")
+	return filtergraph.New("overlay").With("x", x).With("y", y)
+}
+
+// DrawTextFilter returns a drawtext filter rendering text at pos on a translucent box.
+// text may contain drawtext expansions such as %{pts:hms}. fontFile may be empty.
+func DrawTextFilter(text string, pos config.OverlayPosition, margin, size int, fontFile string) filtergraph.Filter {
+	x, y := positionExprs(pos, margin, "w", "h", "tw", "th")
+	f := filtergraph.New("drawtext")
+	if fontFile != "" {
+		f = f.With("fontfile", fontFile)
+	}
+	return f.With("text", text).
+		With("fontsize", size).
+		With("fontcolor", "white").
+		With("box", 1).
+		With("boxcolor", "black@0.5").
+		With("boxborderw", size/3).
+		With("x", x).
+		With("y", y)
+}
+
+// LoudnormFilter returns a loudnorm filter with the configured EBU R128 targets
+func LoudnormFilter(cfg config.VideoConfig) filtergraph.Filter {
+	return filtergraph.New("loudnorm").
+		With("I", strconv.FormatFloat(cfg.LoudnessTarget, 'f', -1, 64)).
+		With("TP", strconv.FormatFloat(cfg.TruePeak, 'f', -1, 64)).
+		With("LRA", strconv.FormatFloat(cfg.LoudnessRange, 'f', -1, 64))
+}
+
+// SDRColorArgs returns the color metadata args for tone mapped SDR output.
+func SDRColorArgs() []string {
+	return []string{
+		"-color_primaries", "bt709",
+		"-color_trc", "bt709",
+		"-colorspace", "bt709",
+	}
+}
+
+// MetadataArgs returns the args that carry the metadata of input 0 over to the output.
+// Stream metadata is copied along with the streams by default. MP4 and MOV only store
+// custom tags such as GPS location with use_metadata_tags. FFmpeg rotates the frames of
+// rotated sources, so a copied "rotate" tag would rotate the output a second time.
+func MetadataArgs(ext string, rotated bool) []string {
+	args := []string{"-map_metadata", "0"}
+	if ext == ".mp4" || ext == ".mov" {
+		args = append(args, "-movflags", "use_metadata_tags")
+	}
+	if rotated {
+		args = append(args, "-metadata:s:v:0", "rotate=0")
+	}
+	return args
+}
+
+// DetermineFrameRate returns the frame-rate-related FFmpeg args for the configured mode.
+func DetermineFrameRate(cfg config.VideoConfig) []string {
+	switch cfg.Fps.Mode {
+	case config.FrameRateFixed:
+		rate := cfg.Fps
+		if cfg.MaxFps.IsSet() && rate.Float() > cfg.MaxFps.Float() {
+			rate = cfg.MaxFps
+		}
+		return []string{"-r", rate.String()}
+
+	case config.FrameRateVFR:
+		if cfg.MaxFps.IsSet() {
+			// vfr drops frames that would share a timestamp at the capped rate
+			return []string{"-fps_mode", "vfr", "-r", cfg.MaxFps.String()}
+		}
+		// Keep the original frame timestamps
+		return []string{"-fps_mode", "passthrough"}
+
+	default:
+		// Source rate: only clamp when the detected rate is higher than the cap
+		if cfg.MaxFps.IsSet() {
+			return []string{"-fpsmax", cfg.MaxFps.String()}
+		}
+		return nil
+	}
+}
+
+// encoderCodecs maps FFmpeg encoder names to the codec names reported by ffprobe.
+var encoderCodecs = map[string]string{
+	"hevc_nvenc": "hevc",
+	"libx265":    "hevc",
+	"libx264":    "h264",
+	"libvpx-vp9": "vp9",
+	"libsvtav1":  "av1",
+	"wmv2":       "wmv2",
+}
+
+// CodecName returns the codec produced by the video encoder in codec args (e.g. "hevc").
+func CodecName(codecArgs []string) string {
+	for i := 0; i+1 < len(codecArgs); i++ {
+		if codecArgs[i] == "-c:v" {
+			return encoderCodecs[codecArgs[i+1]]
+		}
+	}
+	return ""
+}
+
+// MuxerName returns the FFmpeg muxer for an output extension (e.g. ".mkv" becomes "matroska").
+func MuxerName(ext string) string {
+	muxer := strings.TrimPrefix(ext, ".")
+	switch muxer {
+	case "mkv":
+		muxer = "matroska"
+	case "ts":
+		muxer = "mpegts"
+	case "wmv":
+		muxer = "asf"
+	}
+	return muxer
+}
+
 // IsSupportedFormat checks if the given file format is supported
 func IsSupportedFormat(filename string) bool {
 	ext := strings.ToLower(filepath.Ext(filename))
 	return SupportedFormats[ext]
 }
 
+// CheckRunnable runs "ffmpeg -version" to check that the binary at path still starts
+func CheckRunnable(ctx context.Context, path string) error {
+	if _, err := RunCombinedOutput(ctx, DefaultRunner, NewCommand(path, "-version")); err != nil {
+		return fmt.Errorf("ffmpeg is not runnable: %v", err)
+	}
+	return nil
+}
+
+// failureReasons maps fragments of FFmpeg error messages to failure reasons, checked in order
+var failureReasons = []struct {
+	fragment string
+	reason   string
+}{
+	{"nvenc", "gpu_unavailable"},
+	{"cuda", "gpu_unavailable"},
+	{"unknown encoder", "unknown_encoder"},
+	{"invalid data found", "invalid_input"},
+	{"moov atom not found", "invalid_input"},
+	{"no space left", "disk_full"},
+	{"permission denied", "permission_denied"},
+	{"no such file or directory", "file_not_found"},
+	{"error initializing", "invalid_options"},
+	{"option not found", "invalid_options"},
+	{"invalid argument", "invalid_options"},
+	{"signal: killed", "killed"},
+}
+
+// FailureReason classifies the error message of a failed FFmpeg run into a short reason
+// such as "gpu_unavailable" or "invalid_input", "other" if it is not recognized
+func FailureReason(message string) string {
+	message = strings.ToLower(message)
+	for _, r := range failureReasons {
+		if strings.Contains(message, r.fragment) {
+			return r.reason
+		}
+	}
+	return "other"
+}
+
 // CheckFFmpeg checks if ffmpeg is available in PATH or current directory
 func CheckFFmpeg() (string, error) {
 	// Get current working directory
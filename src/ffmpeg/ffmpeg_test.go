@@ -0,0 +1,48 @@
+package ffmpeg
+
+import (
+	"testing"
+
+	"video_compressor/src/config"
+	"video_compressor/src/filtergraph"
+)
+
+func TestFailureReason(t *testing.T) {
+	tests := []struct {
+		message string
+		want    string
+	}{
+		{"gpu encoder error: exit status 1: OpenEncodeSessionEx failed: unsupported device (2): (no details) [hevc_nvenc]", "gpu_unavailable"},
+		{"ffmpeg execution error: exit status 1: Unknown encoder 'libfoo'", "unknown_encoder"},
+		{"ffmpeg execution error: exit status 1: in.mp4: Invalid data found when processing input", "invalid_input"},
+		{"ffmpeg execution error: exit status 1: av_interleaved_write_frame(): No space left on device", "disk_full"},
+		{"ffmpeg execution error: exit status 1", "other"},
+	}
+	for _, tt := range tests {
+		if got := FailureReason(tt.message); got != tt.want {
+			t.Errorf("FailureReason(%q) = %q, want %q", tt.message, got, tt.want)
+		}
+	}
+}
+
+func TestFilterStrings(t *testing.T) {
+	chain := filtergraph.NewChain().Append(ToneMapFilters("")...)
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"tone map", chain.String(), "zscale=t=linear:npl=100,format=gbrpf32le,zscale=p=bt709,tonemap=tonemap=hable:desat=0,zscale=t=bt709:m=bt709:r=tv,format=yuv420p"},
+		{"deinterlace", DeinterlaceFilter("").String(), "bwdif=mode=send_frame:parity=auto:deint=all"},
+		{"subtitle file", SubtitlesFilter(`C:\subs\it's [1].ass`, -1, "").String(), `ass=filename=C\\:\\\\subs\\\\it\\\'s \[1\].ass`},
+		{"embedded subtitles", SubtitlesFilter("/in/a,b.mkv", 2, "/fonts").String(), `subtitles=filename=/in/a\,b.mkv:si=2:fontsdir=/fonts`},
+		{"overlay", OverlayFilter(config.PositionBottomRight, 16).String(), "overlay=x=W-w-16:y=H-h-16"},
+		{"drawtext", DrawTextFilter("%{pts:hms}", config.PositionTopLeft, 10, 24, "").String(),
+			`drawtext=text=%{pts\\:hms}:fontsize=24:fontcolor=white:box=1:boxcolor=black@0.5:boxborderw=8:x=10:y=10`},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+}
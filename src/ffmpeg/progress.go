@@ -0,0 +1,81 @@
+package ffmpeg
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Progress is the encoding progress FFmpeg reports in its status line
+type Progress struct {
+	Time  float64 // Seconds of media encoded so far
+	Speed float64 // Media seconds encoded per second (0 if not reported yet)
+}
+
+// ProgressWriter parses the status lines FFmpeg writes to standard error
+// ("frame=  120 ... time=00:00:04.00 ... speed=1.99x") and calls OnProgress for each
+type ProgressWriter struct {
+	OnProgress func(Progress)
+	line       []byte
+}
+
+// maxStatusLine bounds the buffered line; longer lines are log output, not status lines
+const maxStatusLine = 1024
+
+// Write buffers p and parses every complete line. Status lines end with a carriage return.
+func (w *ProgressWriter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		if b != '\r' && b != '\n' {
+			if len(w.line) < maxStatusLine {
+				w.line = append(w.line, b)
+			}
+			continue
+		}
+		if progress, ok := ParseProgress(string(w.line)); ok && w.OnProgress != nil {
+			w.OnProgress(progress)
+		}
+		w.line = w.line[:0]
+	}
+	return len(p), nil
+}
+
+// ParseProgress parses an FFmpeg status line; ok is false if line is not one
+func ParseProgress(line string) (progress Progress, ok bool) {
+	value, found := statusField(line, "time=")
+	if !found {
+		return Progress{}, false
+	}
+	// "HH:MM:SS.ss", possibly negative at the start of some streams
+	negative := strings.HasPrefix(value, "-")
+	parts := strings.Split(strings.TrimPrefix(value, "-"), ":")
+	if len(parts) != 3 {
+		return Progress{}, false
+	}
+	for _, part := range parts {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return Progress{}, false
+		}
+		progress.Time = progress.Time*60 + n
+	}
+	if negative {
+		progress.Time = 0
+	}
+	if speed, found := statusField(line, "speed="); found {
+		progress.Speed, _ = strconv.ParseFloat(strings.TrimSuffix(speed, "x"), 64)
+	}
+	return progress, true
+}
+
+// statusField returns the value following key in a status line, where FFmpeg pads
+// values with spaces after the equals sign
+func statusField(line, key string) (string, bool) {
+	i := strings.Index(line, key)
+	if i < 0 {
+		return "", false
+	}
+	value := strings.TrimLeft(line[i+len(key):], " ")
+	if end := strings.IndexByte(value, ' '); end >= 0 {
+		value = value[:end]
+	}
+	return value, value != ""
+}
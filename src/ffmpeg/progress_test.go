@@ -0,0 +1,23 @@
+package ffmpeg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProgressWriter(t *testing.T) {
+	var got []Progress
+	w := &ProgressWriter{OnProgress: func(p Progress) { got = append(got, p) }}
+	log := "Input #0, mov,mp4, from 'a.mp4':\n" +
+		"frame=  120 fps= 60 q=28.0 size=     256kB time=00:00:04.00 bitrate= 524.3kbits/s speed=1.99x\r" +
+		"frame=  240 fps= 60 q=28.0 size=     512kB time=00:01:0"
+	// The second status line is split across writes
+	w.Write([]byte(log))
+	w.Write([]byte("2.50 bitrate= 524.3kbits/s speed= 2.1x\r"))
+	w.Write([]byte("frame=    0 fps=0.0 q=0.0 size=       0kB time=N/A bitrate=N/A speed=N/A\r"))
+
+	want := []Progress{{Time: 4, Speed: 1.99}, {Time: 62.5, Speed: 2.1}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("progress = %+v, want %+v", got, want)
+	}
+}
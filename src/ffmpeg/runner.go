@@ -0,0 +1,142 @@
+package ffmpeg
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Runner executes FFmpeg and ffprobe commands
+type Runner interface {
+	Run(ctx context.Context, cmd *Command, stdout, stderr io.Writer) error
+}
+
+// DefaultRunner is the runner used by the processing functions
+var DefaultRunner Runner = ExecRunner{}
+
+// GracefulStopTimeout is how long a cancelled FFmpeg process may take to finish
+// writing its output after receiving "q" before it is killed
+var GracefulStopTimeout = 10 * time.Second
+
+// ExecRunner runs commands as child processes
+type ExecRunner struct{}
+
+// Run executes the command and waits for it to finish. When ctx is cancelled,
+// FFmpeg is asked to stop by sending "q" on stdin and killed after GracefulStopTimeout.
+func (ExecRunner) Run(ctx context.Context, cmd *Command, stdout, stderr io.Writer) error {
+	c := exec.CommandContext(ctx, cmd.Binary, cmd.Args()...)
+	c.Stdout = stdout
+	c.Stderr = stderr
+
+	stdin, err := c.StdinPipe()
+	if err != nil {
+		return err
+	}
+	c.Cancel = func() error {
+		_, err := io.WriteString(stdin, "q")
+		return err
+	}
+	c.WaitDelay = GracefulStopTimeout
+
+	if err := c.Start(); err != nil {
+		return err
+	}
+	err = c.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// RunOutput runs the command and returns its standard output
+func RunOutput(ctx context.Context, r Runner, cmd *Command) ([]byte, error) {
+	var stdout bytes.Buffer
+	err := r.Run(ctx, cmd, &stdout, nil)
+	return stdout.Bytes(), err
+}
+
+// RunCombinedOutput runs the command and returns its standard output and standard error
+func RunCombinedOutput(ctx context.Context, r Runner, cmd *Command) ([]byte, error) {
+	var output bytes.Buffer
+	err := r.Run(ctx, cmd, &output, &output)
+	return output.Bytes(), err
+}
+
+// Invocation is a command recorded by FakeRunner
+type Invocation struct {
+	Binary string
+	Args   []string
+}
+
+// FakeRunner records invocations instead of executing them.
+// Handler, if set, produces the output and error of each invocation.
+type FakeRunner struct {
+	Handler func(inv Invocation, stdout, stderr io.Writer) error
+
+	mu    sync.Mutex
+	calls []Invocation
+}
+
+// Run records the command and calls Handler
+func (f *FakeRunner) Run(ctx context.Context, cmd *Command, stdout, stderr io.Writer) error {
+	inv := Invocation{Binary: cmd.Binary, Args: cmd.Args()}
+	f.mu.Lock()
+	f.calls = append(f.calls, inv)
+	f.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if f.Handler == nil {
+		return nil
+	}
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	if stderr == nil {
+		stderr = io.Discard
+	}
+	return f.Handler(inv, stdout, stderr)
+}
+
+// Calls returns the recorded invocations in order
+func (f *FakeRunner) Calls() []Invocation {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Invocation(nil), f.calls...)
+}
+
+// TailBuffer keeps the last Size bytes written to it, e.g. the end of FFmpeg's log
+type TailBuffer struct {
+	Size int
+	buf  []byte
+}
+
+// Write appends p, discarding the oldest bytes beyond Size
+func (t *TailBuffer) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.Size {
+		t.buf = t.buf[len(t.buf)-t.Size:]
+	}
+	return len(p), nil
+}
+
+// String returns the kept bytes
+func (t *TailBuffer) String() string {
+	return string(t.buf)
+}
+
+// LastLine returns the last non-empty line, which usually holds FFmpeg's error message
+func (t *TailBuffer) LastLine() string {
+	lines := strings.FieldsFunc(string(t.buf), func(r rune) bool { return r == '\n' || r == '\r' })
+	for i := len(lines) - 1; i >= 0; i-- {
+		if line := strings.TrimSpace(lines[i]); line != "" {
+			return line
+		}
+	}
+	return ""
+}
@@ -0,0 +1,155 @@
+package filtergraph
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Option is a single filter option. Key is empty for positional options.
+type Option struct {
+	Key   string
+	Value string
+}
+
+// Filter is a single FFmpeg filter with its options in order
+type Filter struct {
+	Name    string
+	Options []Option
+}
+
+// New creates a filter with optional positional options (e.g. New("scale", "1280", "720"))
+func New(name string, positional ...any) Filter {
+	f := Filter{Name: name}
+	for _, v := range positional {
+		f.Options = append(f.Options, Option{Value: fmt.Sprint(v)})
+	}
+	return f
+}
+
+// With returns a copy of the filter with the named option appended
+func (f Filter) With(key string, value any) Filter {
+	options := make([]Option, len(f.Options), len(f.Options)+1)
+	copy(options, f.Options)
+	f.Options = append(options, Option{Key: key, Value: fmt.Sprint(value)})
+	return f
+}
+
+// String renders the filter as name=opt1:key=value with all values escaped
+func (f Filter) String() string {
+	if len(f.Options) == 0 {
+		return f.Name
+	}
+	parts := make([]string, len(f.Options))
+	for i, o := range f.Options {
+		if o.Key == "" {
+			parts[i] = Escape(o.Value)
+		} else {
+			parts[i] = o.Key + "=" + Escape(o.Value)
+		}
+	}
+	return f.Name + "=" + strings.Join(parts, ":")
+}
+
+// Chain is a linear sequence of filters with optional labeled input and output pads
+type Chain struct {
+	Inputs  []string
+	Filters []Filter
+	Outputs []string
+}
+
+// NewChain creates a chain reading from the given input pad labels
+func NewChain(inputs ...string) *Chain {
+	return &Chain{Inputs: inputs}
+}
+
+// Append adds filters to the end of the chain
+func (c *Chain) Append(filters ...Filter) *Chain {
+	c.Filters = append(c.Filters, filters...)
+	return c
+}
+
+// To sets the output pad labels of the chain
+func (c *Chain) To(outputs ...string) *Chain {
+	c.Outputs = outputs
+	return c
+}
+
+// Empty reports whether the chain contains no filters
+func (c *Chain) Empty() bool {
+	return c == nil || len(c.Filters) == 0
+}
+
+// String renders the chain as [in]filter1,filter2[out]
+func (c *Chain) String() string {
+	var sb strings.Builder
+	for _, label := range c.Inputs {
+		sb.WriteString(Pad(label))
+	}
+	for i, f := range c.Filters {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(f.String())
+	}
+	for _, label := range c.Outputs {
+		sb.WriteString(Pad(label))
+	}
+	return sb.String()
+}
+
+// Graph is a set of chains connected through labeled pads (rendered for -filter_complex)
+type Graph struct {
+	Chains []*Chain
+}
+
+// Add appends a chain to the graph and returns it for further configuration
+func (g *Graph) Add(c *Chain) *Chain {
+	g.Chains = append(g.Chains, c)
+	return c
+}
+
+// Empty reports whether the graph contains no filters
+func (g *Graph) Empty() bool {
+	for _, c := range g.Chains {
+		if !c.Empty() {
+			return false
+		}
+	}
+	return true
+}
+
+// String renders the graph with chains separated by semicolons
+func (g *Graph) String() string {
+	parts := make([]string, 0, len(g.Chains))
+	for _, c := range g.Chains {
+		parts = append(parts, c.String())
+	}
+	return strings.Join(parts, ";")
+}
+
+// Pad renders a pad label, e.g. "0:v" becomes "[0:v]"
+func Pad(label string) string {
+	return "[" + label + "]"
+}
+
+// Escape escapes a filter option value for use inside a filtergraph description.
+// Values are escaped twice: once for the filter option parser (':' and quotes) and
+// once for the filtergraph parser (chain and pad separators).
+func Escape(value string) string {
+	return escapeChars(escapeChars(value, `\':`), `\'[],;`)
+}
+
+// escapeChars prefixes every occurrence of the given characters with a backslash
+func escapeChars(value, chars string) string {
+	if !strings.ContainsAny(value, chars) {
+		return value
+	}
+	var sb strings.Builder
+	for _, r := range value {
+		if strings.ContainsRune(chars, r) {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
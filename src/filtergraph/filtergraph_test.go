@@ -0,0 +1,79 @@
+package filtergraph
+
+import "testing"
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"plain", "bt709", "bt709"},
+		{"colon", "a:b", `a\\:b`},
+		{"quote", "it's", `it\\\'s`},
+		{"backslash", `a\b`, `a\\\\b`},
+		{"comma", "a,b", `a\,b`},
+		{"semicolon", "a;b", `a\;b`},
+		{"brackets", "[in]", `\[in\]`},
+		{"windows path", `C:\subs\a.srt`, `C\\:\\\\subs\\\\a.srt`},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		if got := Escape(tt.value); got != tt.want {
+			t.Errorf("%s: Escape(%q) = %q, want %q", tt.name, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestFilterString(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+		want   string
+	}{
+		{"no options", New("yadif"), "yadif"},
+		{"positional", New("scale", 1280, -2), "scale=1280:-2"},
+		{"named", New("zscale").With("t", "linear").With("npl", 100), "zscale=t=linear:npl=100"},
+		{"mixed", New("hqdn3d", 4, 3).With("x", 1.5), "hqdn3d=4:3:x=1.5"},
+		{"escaped value", New("drawtext").With("text", "a:b, c"), `drawtext=text=a\\:b\, c`},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.String(); got != tt.want {
+			t.Errorf("%s: String() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWithDoesNotShareOptions(t *testing.T) {
+	base := New("scale", 1280, 720)
+	a := base.With("flags", "lanczos")
+	b := base.With("flags", "bicubic")
+	if a.String() != "scale=1280:720:flags=lanczos" || b.String() != "scale=1280:720:flags=bicubic" {
+		t.Errorf("a = %q, b = %q", a, b)
+	}
+}
+
+func TestChainAndGraphString(t *testing.T) {
+	var g Graph
+	if !g.Empty() {
+		t.Error("empty graph is not Empty()")
+	}
+	g.Add(NewChain("1:v")).Append(New("format", "rgba")).To("wm")
+	g.Add(NewChain("0:v", "wm")).Append(New("overlay").With("x", 10).With("y", 10), New("format", "yuv420p")).To("v")
+	want := "[1:v]format=rgba[wm];[0:v][wm]overlay=x=10:y=10,format=yuv420p[v]"
+	if got := g.String(); got != want {
+		t.Errorf("Graph.String() = %q, want %q", got, want)
+	}
+	if g.Empty() {
+		t.Error("graph with filters is Empty()")
+	}
+
+	chain := NewChain().Append(New("crop", 1920, 800, 0, 140), New("scale", 1280, -2))
+	if got := chain.String(); got != "crop=1920:800:0:140,scale=1280:-2" {
+		t.Errorf("Chain.String() = %q", got)
+	}
+	var nilChain *Chain
+	if !nilChain.Empty() || !NewChain("0:a").Empty() {
+		t.Error("chains without filters are not Empty()")
+	}
+}
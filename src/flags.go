@@ -0,0 +1,405 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"video_compressor/src/config"
+	"video_compressor/src/ffmpeg"
+	"video_compressor/src/jobs"
+)
+
+// options holds the values of the flags of a command
+type options struct {
+	input      string
+	output     string
+	configPath string
+	profile    string
+	report     string
+	quiet      bool
+	stdout     *os.File // Standard output before -quiet discarded it
+	jobsPath   string
+	reprocess  bool
+	cfg        config.VideoConfig
+}
+
+// Option lists of the enumerated flags
+var (
+	resolutionOptions  = []string{"4k", "2k", "1080p", "720p", "480p", "360p", "240p"}
+	encoderOptions     = []string{"gpu", "cpu"}
+	positionOptions    = []string{"top-left", "top-right", "bottom-left", "bottom-right", "center"}
+	toneMapOptions     = sortedKeys(config.ToneMapOperators)
+	deinterlaceOptions = sortedKeys(config.DeinterlaceFilters)
+	denoiseOptions     = []string{"off", "light", "medium", "strong"}
+	denoiseFilters     = sortedKeys(config.DenoiseFilters)
+	presetOptions      = append(slices.Clone(ffmpeg.NVENCPresets), ffmpeg.CPUPresets...)
+	extensionOptions   = extensions()
+)
+
+// sortedKeys returns the keys of a set in order
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// extensions returns the supported output extensions with and without the dot
+func extensions() []string {
+	var options []string
+	for _, ext := range sortedKeys(ffmpeg.SupportedFormats) {
+		options = append(options, ext, strings.TrimPrefix(ext, "."))
+	}
+	return options
+}
+
+// choiceValue is a flag restricted to a list of options, converted to T with parse
+type choiceValue[T any] struct {
+	target  *T
+	text    string
+	options []string
+	parse   func(string) (T, error)
+}
+
+// String returns the value as given on the command line
+func (c *choiceValue[T]) String() string {
+	if c == nil {
+		return ""
+	}
+	return c.text
+}
+
+// Set validates and converts the value, suggesting the closest option on a typo
+func (c *choiceValue[T]) Set(s string) error {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if !slices.Contains(c.options, s) {
+		return fmt.Errorf("must be one of %s%s", strings.Join(c.options, ", "), suggestion(s, c.options))
+	}
+	v, err := c.parse(s)
+	if err != nil {
+		return err
+	}
+	*c.target, c.text = v, s
+	return nil
+}
+
+// choiceVar registers a flag accepting one of options; the option list is added to usage
+func choiceVar[T any](fs *flag.FlagSet, target *T, name, value string, options []string, parse func(string) (T, error), usage string) {
+	c := &choiceValue[T]{target: target, options: options, parse: parse}
+	if err := c.Set(value); err != nil {
+		panic(fmt.Sprintf("invalid default for -%s: %v", name, err))
+	}
+	fs.Var(c, name, fmt.Sprintf("%s (options: %s)", usage, strings.Join(options, ", ")))
+}
+
+// stringChoiceVar registers a string flag accepting one of options
+func stringChoiceVar(fs *flag.FlagSet, target *string, name, value string, options []string, usage string) {
+	choiceVar(fs, target, name, value, options, func(s string) (string, error) { return s, nil }, usage)
+}
+
+// frameRateValue is a frame rate flag; empty values are allowed if optional
+type frameRateValue struct {
+	target   *config.FrameRate
+	optional bool
+}
+
+// String returns the frame rate as FFmpeg accepts it
+func (f frameRateValue) String() string {
+	if f.target == nil || (f.optional && !f.target.IsSet()) {
+		return ""
+	}
+	return f.target.String()
+}
+
+// Set parses a frame rate such as source, vfr, 25, 29.97 or 30000/1001
+func (f frameRateValue) Set(s string) error {
+	if f.optional && strings.TrimSpace(s) == "" {
+		*f.target = config.FrameRate{}
+		return nil
+	}
+	rate, err := config.ParseFrameRate(s)
+	if err != nil {
+		return err
+	}
+	if f.optional && !rate.IsSet() {
+		return fmt.Errorf("must be a frame rate such as 30 or 29.97")
+	}
+	*f.target = rate
+	return nil
+}
+
+// listValue is a comma-separated list flag; values are lower-cased
+type listValue struct {
+	target *[]string
+}
+
+// String returns the list joined with commas
+func (l listValue) String() string {
+	if l.target == nil {
+		return ""
+	}
+	return strings.Join(*l.target, ",")
+}
+
+// Set replaces the list with the non-empty comma-separated items of s
+func (l listValue) Set(s string) error {
+	*l.target = nil
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			*l.target = append(*l.target, item)
+		}
+	}
+	return nil
+}
+
+// pathListValue is a repeatable flag collecting paths; each value may hold several
+// comma-separated paths
+type pathListValue struct {
+	target *[]string
+}
+
+// String returns the paths joined with commas
+func (p pathListValue) String() string {
+	if p.target == nil {
+		return ""
+	}
+	return strings.Join(*p.target, ",")
+}
+
+// Set appends the non-empty comma-separated paths of s
+func (p pathListValue) Set(s string) error {
+	for _, path := range strings.Split(s, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			*p.target = append(*p.target, path)
+		}
+	}
+	return nil
+}
+
+// registerCommonFlags registers the input, output and config file flags; there is
+// no output flag if outputUsage is empty
+func registerCommonFlags(fs *flag.FlagSet, o *options, inputUsage, outputUsage string) {
+	fs.StringVar(&o.input, "input", "", inputUsage)
+	if outputUsage != "" {
+		fs.StringVar(&o.output, "output", "", outputUsage)
+	}
+	fs.StringVar(&o.configPath, "config", "", configUsage)
+	fs.StringVar(&o.profile, "profile", "", "Named settings profile (built-in: archive, chat-25mb, phone, web)")
+}
+
+// registerRunFlags registers the flags controlling the run report, console output and dry runs
+func registerRunFlags(fs *flag.FlagSet, o *options) {
+	fs.BoolVar(&o.cfg.DryRun, "dry-run", false, "Analyze the inputs and print the FFmpeg commands without encoding")
+	fs.StringVar(&o.report, "report", "", "Write a JSON report to this file, JSON Lines for directories (- for standard output)")
+	fs.BoolVar(&o.quiet, "quiet", false, "Print nothing on standard output but the report; errors still go to standard error")
+}
+
+// registerJobFlags registers the flags of the job history; reprocess adds the flag
+// forcing inputs that were already processed
+func registerJobFlags(fs *flag.FlagSet, o *options, reprocess bool) {
+	fs.StringVar(&o.jobsPath, "jobs", "", "Job history file (default: "+jobs.DefaultStoreFile+" in the user config directory, none to disable)")
+	if reprocess {
+		fs.BoolVar(&o.reprocess, "reprocess", false, "Compress inputs that were already processed with the same settings")
+	}
+}
+
+// registerVideoFlags registers the encoding flags shared by compress and merge
+func registerVideoFlags(fs *flag.FlagSet, cfg *config.VideoConfig) {
+	// Frame rate and dimensions
+	cfg.Fps = config.FrameRate{Mode: config.FrameRateSource}
+	fs.Var(frameRateValue{target: &cfg.Fps}, "fps", "Frame rate (options: source, vfr, or a rate such as 25, 29.97, 30000/1001)")
+	fs.Var(frameRateValue{target: &cfg.MaxFps, optional: true}, "max-fps", "Maximum frame rate, applied only when the output rate is higher (empty for no cap)")
+	choiceVar(fs, &cfg.Resolution, "resolution", "1080p", resolutionOptions, func(s string) (config.Resolution, error) {
+		return config.StringToResolution(s)
+	}, "Video resolution, ignored if -width and -height are set")
+	fs.IntVar(&cfg.Width, "width", 0, "Custom width (0 for default)")
+	fs.IntVar(&cfg.Height, "height", 0, "Custom height (0 for default)")
+	choiceVar(fs, &cfg.ScalePolicy, "scale-policy", "never", []string{"never", "allow", "fit"}, config.StringToScalePolicy, "Scale policy")
+	fs.IntVar(&cfg.MaxWidth, "max-width", 0, "Maximum output width (0 for unbounded)")
+	fs.IntVar(&cfg.MaxHeight, "max-height", 0, "Maximum output height (0 for unbounded)")
+	fs.BoolVar(&cfg.AutoCrop, "autocrop", false, "Detect and remove black borders (letterboxing) before scaling")
+
+	// Encoder and quality
+	fs.IntVar(&cfg.Bitrate, "bitrate", 0, "Custom bitrate in Kbps (0 for default)")
+	stringChoiceVar(fs, &cfg.Preset, "preset", "p7", presetOptions, "Encoder preset (p1=fastest, p7=best quality; CPU presets are also accepted)")
+	fs.IntVar(&cfg.Cq, "cq", 32, "Constant quality value (0-51, lower is better)")
+	stringChoiceVar(fs, &cfg.Encoder, "encoder", "gpu", encoderOptions, "Encoder type")
+	choiceVar(fs, &cfg.OutputExtension, "output-extension", ".mp4", extensionOptions, func(s string) (string, error) {
+		return "." + strings.TrimPrefix(s, "."), nil
+	}, "Output file extension")
+	choiceVar(fs, &cfg.Overwrite, "overwrite", "never", []string{"never", "always", "if-smaller"}, config.StringToOverwritePolicy, "Existing output handling")
+
+	// Color and restoration filters
+	choiceVar(fs, &cfg.HDRMode, "hdr", "tonemap", []string{"tonemap", "preserve", "off"}, config.StringToHDRMode, "HDR source handling")
+	stringChoiceVar(fs, &cfg.ToneMapOperator, "tonemap", "hable", toneMapOptions, "Tone mapping operator")
+	choiceVar(fs, &cfg.Deinterlace, "deinterlace", "auto", []string{"auto", "on", "off"}, config.StringToDeinterlaceMode, "Deinterlacing")
+	stringChoiceVar(fs, &cfg.DeinterlaceFilter, "deinterlace-filter", "bwdif", deinterlaceOptions, "Deinterlacing filter")
+	stringChoiceVar(fs, &cfg.Denoise, "denoise", "off", denoiseOptions, "Denoise strength")
+	stringChoiceVar(fs, &cfg.DenoiseFilter, "denoise-filter", "hqdn3d", denoiseFilters, "Denoising filter")
+
+	// Streams and subtitles
+	choiceVar(fs, &cfg.Audio, "audio", "all", []string{"all", "first", "language"}, config.StringToAudioSelection, "Audio streams to keep")
+	fs.Var(listValue{&cfg.AudioLanguages}, "audio-lang", "Comma-separated audio languages kept with -audio language (e.g. eng,jpn)")
+	choiceVar(fs, &cfg.Subtitles, "subtitles", "copy", []string{"copy", "drop"}, config.StringToSubtitleMode, "Embedded subtitles")
+	fs.IntVar(&cfg.BurnSubtitleTrack, "burn-subtitle-track", 0, "Embedded subtitle track to burn into the picture, starting at 1 (0 to disable)")
+	fs.StringVar(&cfg.FontsDir, "fonts-dir", "", "Font directory for burned subtitles")
+
+	// Overlays
+	fs.StringVar(&cfg.Watermark, "watermark", "", "Image file overlaid as a watermark")
+	choiceVar(fs, &cfg.WatermarkPosition, "watermark-position", "bottom-right", positionOptions, config.StringToOverlayPosition, "Watermark position")
+	fs.IntVar(&cfg.WatermarkMargin, "watermark-margin", 20, "Distance of the watermark and text from the edges in pixels")
+	fs.Float64Var(&cfg.WatermarkScale, "watermark-scale", 0.15, "Watermark width relative to the output width (0 keeps the image size)")
+	fs.Float64Var(&cfg.WatermarkOpacity, "watermark-opacity", 1, "Watermark opacity (0-1)")
+	fs.StringVar(&cfg.Text, "text", "", "Text overlay; {filename}, {date} and {timecode} are replaced")
+	choiceVar(fs, &cfg.TextPosition, "text-position", "bottom-left", positionOptions, config.StringToOverlayPosition, "Text position")
+	fs.IntVar(&cfg.TextSize, "text-size", 24, "Text font size in pixels")
+	fs.StringVar(&cfg.TextFontFile, "text-font", "", "Font file for the text overlay (default: system font)")
+
+	// Audio loudness
+	fs.BoolVar(&cfg.Loudnorm, "loudnorm", false, "Normalize audio loudness (EBU R128, two-pass loudnorm)")
+	fs.Float64Var(&cfg.LoudnessTarget, "loudness", -23, "Integrated loudness target in LUFS (-70 to -5)")
+	fs.Float64Var(&cfg.TruePeak, "true-peak", -1, "Maximum true peak in dBTP (-9 to 0)")
+	fs.Float64Var(&cfg.LoudnessRange, "lra", 7, "Loudness range target in LU (1 to 50)")
+
+	// Metadata
+	fs.BoolVar(&cfg.PreserveMetadata, "metadata", true, "Preserve metadata (creation time, location, rotation) and file timestamps")
+	fs.BoolVar(&cfg.CopyXattrs, "xattrs", false, "Copy extended file attributes to the output (Linux only)")
+}
+
+// registerCompressFlags registers the flags that only apply to compress
+func registerCompressFlags(fs *flag.FlagSet, cfg *config.VideoConfig) {
+	fs.Float64Var(&cfg.SkipBelowBpp, "skip-below-bpp", 0, "Skip inputs below this many bits per pixel (0 to disable)")
+	fs.BoolVar(&cfg.SkipTargetCodec, "skip-target-codec", false, "Skip inputs already in the target codec at or under the target resolution")
+	fs.Float64Var(&cfg.MinSavingPercent, "min-saving", 0, "Discard outputs that save less than this percentage of the input size")
+	choiceVar(fs, &cfg.SkipAction, "on-skip", "keep", []string{"keep", "copy"}, config.StringToSkipAction, "Skipped or discarded inputs: keep in place or copy the original to the output")
+	fs.StringVar(&cfg.BurnSubtitles, "burn-subtitles", "", "Subtitle file (.srt, .ass, .ssa, .vtt) to burn into the picture")
+	fs.BoolVar(&cfg.SidecarSubtitles, "sidecar-subtitles", false, "Add subtitle files named like the input (e.g. video.en.srt) as subtitle tracks")
+}
+
+// registerMergeFlags registers the flags that only apply to merge
+func registerMergeFlags(fs *flag.FlagSet, cfg *config.VideoConfig) {
+	fs.BoolVar(&cfg.Reverse, "reverse", false, "Reverse the order of the files to be merged")
+	choiceVar(fs, &cfg.OverlayScope, "overlay-scope", "output", []string{"output", "segment"}, config.StringToOverlayScope, "Where overlays are applied")
+}
+
+// registerSettingFlags registers every flag that can be set in a config file
+func registerSettingFlags(fs *flag.FlagSet, cfg *config.VideoConfig) {
+	registerVideoFlags(fs, cfg)
+	registerCompressFlags(fs, cfg)
+	registerMergeFlags(fs, cfg)
+}
+
+// settingNames returns the names of all flags that can be set in a config file
+func settingNames() []string {
+	fs := flag.NewFlagSet("settings", flag.ContinueOnError)
+	registerSettingFlags(fs, &config.VideoConfig{})
+	var names []string
+	fs.VisitAll(func(f *flag.Flag) { names = append(names, f.Name) })
+	return names
+}
+
+// configUsage is the usage of the -config flag
+const configUsage = "JSON, YAML or TOML config file (default: video_compressor.json, .yaml, .yml or .toml if present)"
+
+// loadConfigFile loads the config file at path, or the first of config.DefaultConfigFiles
+// that exists if path is empty. It returns nil if there is no config file.
+func loadConfigFile(path string) (*config.File, error) {
+	if path == "" {
+		if path = config.FindDefaultFile(); path == "" {
+			return nil, nil
+		}
+	}
+	return config.LoadFile(path)
+}
+
+// applyConfigFile sets the flags of fs that were not given on the command line from the
+// config file and the named profile. Settings of flags that belong to other commands
+// are ignored.
+func applyConfigFile(fs *flag.FlagSet, path, profile string) error {
+	file, err := loadConfigFile(path)
+	if err != nil {
+		return err
+	}
+	settings, err := config.ResolveSettings(file, profile)
+	if err != nil {
+		return err
+	}
+
+	known := settingNames()
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	for name, value := range settings {
+		if !slices.Contains(known, name) {
+			return fmt.Errorf("unknown setting %q in config%s", name, suggestion(name, known))
+		}
+		if explicit[name] || fs.Lookup(name) == nil {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("invalid value %q for %s in config: %v", value, name, err)
+		}
+	}
+	return nil
+}
+
+// validateConfig checks the numeric ranges and combinations that flags cannot express
+func validateConfig(cfg config.VideoConfig) error {
+	switch {
+	case cfg.Cq < 0 || cfg.Cq > 51:
+		return fmt.Errorf("-cq must be between 0 and 51: %d", cfg.Cq)
+	case cfg.Bitrate < 0 || cfg.Width < 0 || cfg.Height < 0 || cfg.MaxWidth < 0 || cfg.MaxHeight < 0:
+		return fmt.Errorf("bitrate and dimensions must not be negative")
+	case (cfg.Width == 0) != (cfg.Height == 0):
+		return fmt.Errorf("-width and -height must be set together")
+	case cfg.WatermarkOpacity < 0 || cfg.WatermarkOpacity > 1:
+		return fmt.Errorf("-watermark-opacity must be between 0 and 1: %g", cfg.WatermarkOpacity)
+	case cfg.LoudnessTarget < -70 || cfg.LoudnessTarget > -5 || cfg.TruePeak < -9 || cfg.TruePeak > 0 ||
+		cfg.LoudnessRange < 1 || cfg.LoudnessRange > 50:
+		return fmt.Errorf("loudness targets out of range (loudness -70 to -5, true-peak -9 to 0, lra 1 to 50)")
+	case cfg.Audio == config.AudioLanguage && len(cfg.AudioLanguages) == 0:
+		return fmt.Errorf("-audio language requires -audio-lang")
+	}
+	return nil
+}
+
+// suggestion returns ` (did you mean "x"?)` for the option closest to value, or "" if
+// no option is close enough
+func suggestion(value string, options []string) string {
+	best, bestDistance := "", len(value)/2+2
+	for _, o := range options {
+		if d := editDistance(value, o); d < bestDistance {
+			best, bestDistance = o, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (did you mean %q?)", best)
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"video_compressor/src/config"
+)
+
+func TestChoiceValue(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	var cfg config.VideoConfig
+	registerVideoFlags(fs, &cfg)
+
+	if err := fs.Set("resolution", "720P"); err != nil || cfg.Resolution != config.Resolution720p {
+		t.Errorf("Set(720P) = %v, resolution %q", err, cfg.Resolution)
+	}
+	if err := fs.Set("output-extension", "mkv"); err != nil || cfg.OutputExtension != ".mkv" {
+		t.Errorf("Set(mkv) = %v, extension %q", err, cfg.OutputExtension)
+	}
+
+	err := fs.Set("encoder", "gpux")
+	if err == nil || !strings.Contains(err.Error(), `did you mean "gpu"?`) {
+		t.Errorf("Set(gpux) = %v, want a suggestion", err)
+	}
+	if cfg.Encoder != "gpu" {
+		t.Errorf("encoder = %q after invalid value, want unchanged gpu", cfg.Encoder)
+	}
+	if err := fs.Set("preset", "zzzzzzzz"); err == nil || strings.Contains(err.Error(), "did you mean") {
+		t.Errorf("Set(zzzzzzzz) = %v, want an error without suggestion", err)
+	}
+}
+
+func TestLegacyArgs(t *testing.T) {
+	got := legacyArgs([]string{"-input", "clips", "-mode", "merge", "-reverse", "true", "-cq", "28"})
+	want := []string{"merge", "-input", "clips", "-reverse=true", "-cq", "28"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("legacyArgs() = %q, want %q", got, want)
+	}
+	got = legacyArgs([]string{"-input=a.mp4"})
+	if want := []string{"compress", "-input=a.mp4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("legacyArgs() = %q, want %q", got, want)
+	}
+}
+
+func TestApplyConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.json")
+	data := `{"cq": "30", "reverse": "true", "encoder": "cpu"}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := flag.NewFlagSet("compress", flag.ContinueOnError)
+	var cfg config.VideoConfig
+	registerVideoFlags(fs, &cfg)
+	registerCompressFlags(fs, &cfg)
+	if err := fs.Parse([]string{"-cq", "20"}); err != nil {
+		t.Fatal(err)
+	}
+	// reverse belongs to merge and is ignored; the command line wins over the file
+	if err := applyConfigFile(fs, path, ""); err != nil {
+		t.Fatalf("applyConfigFile() error = %v", err)
+	}
+	if cfg.Cq != 20 || cfg.Encoder != "cpu" {
+		t.Errorf("cq = %d, encoder = %q, want 20 and cpu", cfg.Cq, cfg.Encoder)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"encodr": "cpu"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyConfigFile(fs, path, ""); err == nil || !strings.Contains(err.Error(), `did you mean "encoder"?`) {
+		t.Errorf("applyConfigFile() error = %v, want unknown setting with suggestion", err)
+	}
+}
+
+func TestJobConfigResolver(t *testing.T) {
+	resolve := jobConfigResolver("", "ffmpeg")
+	cfg, err := resolve("web", config.Settings{"cq": "20"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Inline settings win over the profile
+	if cfg.Cq != 20 || cfg.OutputExtension != ".mp4" || !cfg.Loudnorm || cfg.FfmpegPath != "ffmpeg" {
+		t.Errorf("cfg = cq %d, extension %q, loudnorm %v, ffmpeg %q", cfg.Cq, cfg.OutputExtension, cfg.Loudnorm, cfg.FfmpegPath)
+	}
+	if _, err := resolve("", config.Settings{"reverse": "true"}); err == nil {
+		t.Error("resolve() accepted a merge setting")
+	}
+	if _, err := resolve("", config.Settings{"cq": "80"}); err == nil {
+		t.Error("resolve() accepted an out-of-range cq")
+	}
+}
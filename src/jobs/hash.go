@@ -0,0 +1,58 @@
+package jobs
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"video_compressor/src/config"
+)
+
+// hashChunkSize is the size of each of the three chunks read by HashFile
+const hashChunkSize = 1 << 20
+
+// HashFile returns a fingerprint of the file's content: a SHA-256 of its size and of
+// its first, middle and last megabyte. Reading whole videos would take as long as a
+// fast encode; edits and re-exports change the size or these chunks.
+func HashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open input: %v", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", fmt.Errorf("failed to stat input: %v", err)
+	}
+
+	h := sha256.New()
+	size := info.Size()
+	binary.Write(h, binary.LittleEndian, size)
+	offsets := []int64{0}
+	if size > hashChunkSize {
+		offsets = append(offsets, size/2-hashChunkSize/2, size-hashChunkSize)
+	}
+	for _, offset := range offsets {
+		if _, err := io.Copy(h, io.NewSectionReader(f, offset, hashChunkSize)); err != nil {
+			return "", fmt.Errorf("failed to read input: %v", err)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ConfigHash returns a hash of the settings that affect the output of a compression.
+// The FFmpeg path, dry runs, the overwrite policy and merge-only settings are ignored.
+func ConfigHash(cfg config.VideoConfig) string {
+	cfg.FfmpegPath = ""
+	cfg.DryRun = false
+	cfg.Overwrite = ""
+	cfg.Reverse = false
+	cfg.OverlayScope = ""
+	data, _ := json.Marshal(cfg)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,424 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"video_compressor/src/config"
+)
+
+// Status is the state of a job
+type Status string
+
+const (
+	StatusQueued    Status = "queued"    // Waiting for a worker
+	StatusRunning   Status = "running"   // Being processed
+	StatusSucceeded Status = "succeeded" // Processed; the output was written, kept or deliberately skipped
+	StatusFailed    Status = "failed"    // Processing failed
+	StatusCancelled Status = "cancelled" // Cancelled by the user or interrupted
+)
+
+// Statuses lists the job statuses
+var Statuses = []Status{StatusQueued, StatusRunning, StatusSucceeded, StatusFailed, StatusCancelled}
+
+// StringToStatus converts a string to Status type
+func StringToStatus(s string) (Status, error) {
+	for _, status := range Statuses {
+		if Status(strings.ToLower(s)) == status {
+			return status, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported job status: %s", s)
+}
+
+// Finished reports whether the status is final
+func (s Status) Finished() bool {
+	return s == StatusSucceeded || s == StatusFailed || s == StatusCancelled
+}
+
+// Job is a compression of one input with one configuration
+type Job struct {
+	ID         string             `json:"id"`
+	Input      string             `json:"input"`
+	InputHash  string             `json:"input_hash"`
+	Output     string             `json:"output"` // Requested output path without extension
+	Config     config.VideoConfig `json:"config"`
+	ConfigHash string             `json:"config_hash"`
+	Status     Status             `json:"status"`
+	Attempts   int                `json:"attempts"`
+	Created    time.Time          `json:"created"`
+	Started    time.Time          `json:"started"`
+	Finished   time.Time          `json:"finished"`
+	Error      string             `json:"error,omitempty"`
+
+	// Outcome of the last attempt
+	Written    string  `json:"written,omitempty"` // Path that was written, empty if nothing was written
+	Decision   string  `json:"decision,omitempty"`
+	InputSize  int64   `json:"input_size"`
+	OutputSize int64   `json:"output_size"`
+	Encoder    string  `json:"encoder,omitempty"`
+	WallTime   float64 `json:"wall_time"`
+	Speed      float64 `json:"speed,omitempty"`
+}
+
+// Updated returns the time of the last change of the job
+func (j *Job) Updated() time.Time {
+	switch {
+	case !j.Finished.IsZero():
+		return j.Finished
+	case !j.Started.IsZero():
+		return j.Started
+	}
+	return j.Created
+}
+
+// OutputExists reports whether the output the job wrote is still in place with the size
+// it was written with. Jobs that wrote nothing, e.g. skipped inputs, have no output to lose.
+func (j *Job) OutputExists() bool {
+	if j.Written == "" {
+		return true
+	}
+	info, err := os.Stat(j.Written)
+	return err == nil && !info.IsDir() && (j.OutputSize <= 0 || info.Size() == j.OutputSize)
+}
+
+// Store is a job history kept in a JSON file. Every change reads and rewrites the file
+// while holding a lock file next to it, so several processes can share the history.
+type Store struct {
+	path string
+	mu   sync.Mutex
+}
+
+// DefaultStoreFile is the name of the job history in the user configuration directory
+const DefaultStoreFile = "jobs.json"
+
+// DefaultPath returns the path of the job history used when none is given
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot locate the configuration directory: %v", err)
+	}
+	return filepath.Join(dir, "video_compressor", DefaultStoreFile), nil
+}
+
+// Open opens the job history at path, creating its directory if needed
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create job history directory: %v", err)
+	}
+	s := &Store{path: path}
+	if _, err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Path returns the file of the store
+func (s *Store) Path() string {
+	return s.path
+}
+
+// List returns the jobs in the order they were created
+func (s *Store) List() ([]Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
+}
+
+// Get returns the job with the given ID
+func (s *Store) Get(id string) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs, err := s.load()
+	if err != nil {
+		return Job{}, err
+	}
+	if i := find(jobs, id); i >= 0 {
+		return jobs[i], nil
+	}
+	return Job{}, fmt.Errorf("job not found: %s", id)
+}
+
+// Add stores a new job with a fresh ID and returns it
+func (s *Store) Add(job Job) (Job, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return Job{}, err
+	}
+	defer unlock()
+	jobs, err := s.load()
+	if err != nil {
+		return Job{}, err
+	}
+	job.ID = newID()
+	if job.Created.IsZero() {
+		job.Created = time.Now()
+	}
+	if job.Status == "" {
+		job.Status = StatusQueued
+	}
+	jobs = append(jobs, job)
+	return job, s.save(jobs)
+}
+
+// Update applies fn to the job with the given ID and stores the result. The job is not
+// changed if fn returns an error.
+func (s *Store) Update(id string, fn func(job *Job) error) (Job, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return Job{}, err
+	}
+	defer unlock()
+	jobs, err := s.load()
+	if err != nil {
+		return Job{}, err
+	}
+	i := find(jobs, id)
+	if i < 0 {
+		return Job{}, fmt.Errorf("job not found: %s", id)
+	}
+	job := jobs[i]
+	if err := fn(&job); err != nil {
+		return Job{}, err
+	}
+	jobs[i] = job
+	return job, s.save(jobs)
+}
+
+// Remove deletes the jobs for which match returns true and returns how many were deleted
+func (s *Store) Remove(match func(job Job) bool) (int, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	jobs, err := s.load()
+	if err != nil {
+		return 0, err
+	}
+	kept := jobs[:0]
+	for _, job := range jobs {
+		if !match(job) {
+			kept = append(kept, job)
+		}
+	}
+	removed := len(jobs) - len(kept)
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, s.save(kept)
+}
+
+// Start marks a job as running and counts the attempt. A job without ID resumes the
+// queued, failed or cancelled job with the same input, settings and output, or is added.
+func (s *Store) Start(job Job) (Job, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return Job{}, err
+	}
+	defer unlock()
+	jobs, err := s.load()
+	if err != nil {
+		return Job{}, err
+	}
+	i := -1
+	if job.ID != "" {
+		if i = find(jobs, job.ID); i < 0 {
+			return Job{}, fmt.Errorf("job not found: %s", job.ID)
+		}
+		jobs[i].InputHash, jobs[i].ConfigHash = job.InputHash, job.ConfigHash
+	} else {
+		for k := len(jobs) - 1; k >= 0 && i < 0; k-- {
+			j := jobs[k]
+			if j.Status != StatusSucceeded && j.Status != StatusRunning && j.Input == job.Input && j.Output == job.Output &&
+				j.InputHash == job.InputHash && j.ConfigHash == job.ConfigHash {
+				i = k
+			}
+		}
+		if i < 0 {
+			job.ID, job.Created = newID(), time.Now()
+			jobs = append(jobs, job)
+			i = len(jobs) - 1
+		}
+	}
+	if jobs[i].Status == StatusRunning {
+		return Job{}, fmt.Errorf("job %s is already running", jobs[i].ID)
+	}
+	jobs[i].Status, jobs[i].Started, jobs[i].Finished, jobs[i].Error = StatusRunning, time.Now(), time.Time{}, ""
+	jobs[i].Attempts++
+	return jobs[i], s.save(jobs)
+}
+
+// Relocate changes the input of the jobs of a file that was moved
+func (s *Store) Relocate(oldPath, newPath string) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	jobs, err := s.load()
+	if err != nil {
+		return err
+	}
+	for i := range jobs {
+		if jobs[i].Input == oldPath {
+			jobs[i].Input = newPath
+		}
+	}
+	return s.save(jobs)
+}
+
+// Processed returns the last job that succeeded for the input and config hashes and
+// whose output is still in place
+func (s *Store) Processed(inputHash, configHash string) (Job, bool, error) {
+	jobs, err := s.List()
+	if err != nil {
+		return Job{}, false, err
+	}
+	for i := len(jobs) - 1; i >= 0; i-- {
+		job := jobs[i]
+		if job.Status == StatusSucceeded && job.InputHash == inputHash && job.ConfigHash == configHash && job.OutputExists() {
+			return job, true, nil
+		}
+	}
+	return Job{}, false, nil
+}
+
+// Cancel marks a queued or running job as cancelled. A running job stops once its
+// process notices, see WatchCancel.
+func (s *Store) Cancel(id string) (Job, error) {
+	return s.Update(id, func(job *Job) error {
+		if job.Status.Finished() {
+			return fmt.Errorf("job %s is already %s", job.ID, job.Status)
+		}
+		job.Status, job.Finished, job.Error = StatusCancelled, time.Now(), "cancelled"
+		return nil
+	})
+}
+
+// WatchCancel returns a context that is cancelled when the job is cancelled in the store,
+// checked every interval. The returned function releases it.
+func (s *Store) WatchCancel(ctx context.Context, id string, interval time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if job, err := s.Get(id); err == nil && job.Status == StatusCancelled {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	return ctx, cancel
+}
+
+// load reads the jobs, returning none if the file does not exist yet
+func (s *Store) load() ([]Job, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read job history: %v", err)
+	}
+	var jobs []Job
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return nil, fmt.Errorf("invalid job history %s: %v", s.path, err)
+	}
+	sort.SliceStable(jobs, func(i, j int) bool { return jobs[i].Created.Before(jobs[j].Created) })
+	return jobs, nil
+}
+
+// lockTimeout is how long a change waits for the lock file, and the age after which a
+// lock file is considered left behind by a crashed process
+const lockTimeout = 10 * time.Second
+
+// lock serializes changes to the file within this process and with other processes.
+// The returned function releases the lock.
+func (s *Store) lock() (func(), error) {
+	s.mu.Lock()
+	path := s.path + ".lock"
+	for deadline := time.Now().Add(lockTimeout); ; time.Sleep(10 * time.Millisecond) {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			return func() {
+				os.Remove(path)
+				s.mu.Unlock()
+			}, nil
+		}
+		if !os.IsExist(err) {
+			s.mu.Unlock()
+			return nil, fmt.Errorf("failed to lock job history: %v", err)
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > lockTimeout {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			s.mu.Unlock()
+			return nil, fmt.Errorf("failed to lock job history: %s is held by another process", path)
+		}
+	}
+}
+
+// save writes the jobs atomically through a temporary file in the same directory
+func (s *Store) save(jobs []Job) error {
+	if jobs == nil {
+		jobs = []Job{}
+	}
+	data, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write job history: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write job history: %v", err)
+	}
+	return nil
+}
+
+// find returns the index of the job with the given ID, or -1
+func find(jobs []Job, id string) int {
+	for i := range jobs {
+		if jobs[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// newID returns a random job ID
+func newID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
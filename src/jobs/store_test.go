@@ -0,0 +1,158 @@
+package jobs
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"video_compressor/src/config"
+)
+
+func TestStoreLifecycle(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "history", "jobs.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := Job{Input: "/in/a.mp4", Output: "/out/a", InputHash: "in", ConfigHash: "cfg"}
+
+	first, err := store.Start(job)
+	if err != nil || first.Status != StatusRunning || first.Attempts != 1 {
+		t.Fatalf("Start() = %+v, %v, want a running first attempt", first, err)
+	}
+	if _, err := store.Start(Job{ID: first.ID}); err == nil {
+		t.Error("Start() of a running job succeeded")
+	}
+	if _, err := store.Update(first.ID, func(j *Job) error { j.Status = StatusFailed; return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	// The failed job is resumed instead of adding another one
+	second, err := store.Start(job)
+	if err != nil || second.ID != first.ID || second.Attempts != 2 {
+		t.Fatalf("Start() = %+v, %v, want attempt 2 of job %s", second, err, first.ID)
+	}
+	if _, found, _ := store.Processed("in", "cfg"); found {
+		t.Error("Processed() found a running job")
+	}
+	if _, err := store.Update(first.ID, func(j *Job) error { j.Status = StatusSucceeded; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if done, found, err := store.Processed("in", "cfg"); err != nil || !found || done.ID != first.ID {
+		t.Errorf("Processed() = %+v, %v, %v, want job %s", done, found, err, first.ID)
+	}
+	if _, found, _ := store.Processed("in", "other"); found {
+		t.Error("Processed() matched another config hash")
+	}
+
+	queued, err := store.Add(Job{Input: "/in/b.mp4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cancelled, err := store.Cancel(queued.ID); err != nil || cancelled.Status != StatusCancelled {
+		t.Errorf("Cancel() = %+v, %v", cancelled, err)
+	}
+	if _, err := store.Cancel(first.ID); err == nil {
+		t.Error("Cancel() of a succeeded job succeeded")
+	}
+
+	n, err := store.Remove(func(j Job) bool { return j.Status == StatusCancelled })
+	if err != nil || n != 1 {
+		t.Errorf("Remove() = %d, %v, want 1", n, err)
+	}
+	list, err := store.List()
+	if err != nil || len(list) != 1 || list[0].ID != first.ID {
+		t.Errorf("List() = %+v, %v, want only job %s", list, err, first.ID)
+	}
+}
+
+func TestProcessedOutputRemoved(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open(filepath.Join(dir, "jobs.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	written := filepath.Join(dir, "a.mp4")
+	if err := os.WriteFile(written, []byte("small"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	job, err := store.Add(Job{Input: "/in/a.mp4", InputHash: "in", ConfigHash: "cfg", Status: StatusSucceeded, Written: written, OutputSize: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if done, found, _ := store.Processed("in", "cfg"); !found || done.ID != job.ID {
+		t.Errorf("Processed() = %+v, %v, want job %s", done, found, job.ID)
+	}
+	// An output that was replaced or deleted has to be written again
+	if err := os.WriteFile(written, []byte("replaced"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, _ := store.Processed("in", "cfg"); found {
+		t.Error("Processed() found a job whose output was replaced")
+	}
+	os.Remove(written)
+	if _, found, _ := store.Processed("in", "cfg"); found {
+		t.Error("Processed() found a job whose output was deleted")
+	}
+}
+
+func TestStoreConcurrentProcesses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	// Separate stores on the same file behave like separate processes
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		store, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := 0; k < 10; k++ {
+				if _, err := store.Add(Job{Input: "/in/a.mp4"}); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	store, _ := Open(path)
+	if list, err := store.List(); err != nil || len(list) != 40 {
+		t.Errorf("List() = %d jobs, %v, want 40", len(list), err)
+	}
+	if leftovers, _ := filepath.Glob(path + ".*"); len(leftovers) != 0 {
+		t.Errorf("leftover files %v", leftovers)
+	}
+}
+
+func TestHashes(t *testing.T) {
+	cfg := config.VideoConfig{Cq: 28, Encoder: "cpu", FfmpegPath: "/usr/bin/ffmpeg"}
+	same := cfg
+	same.FfmpegPath, same.DryRun = "ffmpeg", true
+	if ConfigHash(cfg) != ConfigHash(same) {
+		t.Error("ConfigHash() depends on the FFmpeg path or dry run")
+	}
+	other := cfg
+	other.Cq = 30
+	if ConfigHash(cfg) == ConfigHash(other) {
+		t.Error("ConfigHash() ignores the CQ")
+	}
+
+	path := filepath.Join(t.TempDir(), "a.mp4")
+	data := make([]byte, 3*hashChunkSize)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	before, err := HashFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A change in the middle chunk changes the hash
+	data[len(data)/2] = 1
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := HashFile(path); after == before {
+		t.Error("HashFile() did not change with the content")
+	}
+}
@@ -1,147 +1,129 @@
 package main
 
 import (
-	"flag"
 	"fmt"
 	"os"
-	"path/filepath"
 	"strings"
-	"time"
-
-	"video_compressor/src/config"
-	"video_compressor/src/ffmpeg"
-	"video_compressor/src/utils"
-	"video_compressor/src/video"
 )
 
-func main() {
-	// Parse command line arguments
-	inputPath := flag.String("input", "", "Input video file path")
-	outputPath := flag.String("output", "", "Output video file path (default: use input file name)")
-	reverse := flag.String("reverse", "false", "Reverse the order of the files to be merged")
-
-	// Video compression parameters
-	mode := flag.String("mode", "compress", "Mode (options: compress, merge)")
-	fps := flag.Int("fps", 32, "Frame rate (default: 32)")
-	resolution := flag.String("resolution", "", "Video resolution (options: 1080p, 720p, 480p)")
-	bitrate := flag.Int("bitrate", 0, "Custom bitrate in Kbps (0 for default)")
-	preset := flag.String("preset", "p7", "Encoder preset (p1=fastest, p7=best quality)")
-	cq := flag.Int("cq", 32, "Constant quality value (0-51, lower is better)")
-	width := flag.Int("width", 0, "Custom width (0 for default)")
-	height := flag.Int("height", 0, "Custom height (0 for default)")
-	encoder := flag.String("encoder", "gpu", "Encoder type (options: gpu, cpu)")
-	outputExtension := flag.String("output-extension", ".mp4", "Output file extension (default: .mp4)")
+// Exit statuses
+const (
+	exitOK          = 0
+	exitError       = 1
+	exitUsage       = 2
+	exitInterrupted = 130 // Processing was cancelled by a signal
+)
 
-	flag.Parse()
+// command is a subcommand of the CLI
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
 
-	// check ffmpeg
-	ffmpegPath, err := ffmpeg.CheckFFmpeg()
-	if err != nil {
-		fmt.Println("FFmpeg not found, attempting to download...")
-		if err := ffmpeg.DownloadFFmpeg(); err != nil {
-			fmt.Println("Error: Failed to download FFmpeg:", err)
-			return
-		}
-		ffmpegPath, err = ffmpeg.CheckFFmpeg()
-		if err != nil {
-			fmt.Println("Error: FFmpeg still not found after download:", err)
-			return
-		}
-	}
+// commands lists the subcommands in the order shown by help
+var commands = []command{
+	{"compress", "Compress a video file or every video in a directory", runCompress},
+	{"merge", "Merge the videos in a directory into one file", runMerge},
+	{"watch", "Compress new videos arriving in watched directories", runWatch},
+	{"serve", "Serve a REST API to submit and monitor compression jobs", runServe},
+	{"jobs", "List, retry, cancel or purge the jobs of the history", runJobs},
+	{"estimate", "Estimate output size and encode time from sample encodes", runEstimate},
+	{"probe", "Show the streams and properties of a video", runProbe},
+	{"split", "Split a video into segments without re-encoding", runSplit},
+	{"config", "Show the effective configuration or list profiles", runConfig},
+}
 
-	// Trim whitespace from input and output paths
-	*inputPath = strings.TrimSpace(*inputPath)
-	*outputPath = strings.TrimSpace(*outputPath)
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
 
-	// Ensure that an input path was provided
-	if *inputPath == "" {
-		fmt.Fprintln(os.Stderr, "Error: --input flag is required")
-		os.Exit(1)
+// run dispatches args to a subcommand and returns the exit status
+func run(args []string) int {
+	if len(args) == 0 {
+		printUsage()
+		return exitUsage
 	}
-
-	// Check if input file exists
-	if _, err := os.Stat(*inputPath); os.IsNotExist(err) {
-		fmt.Printf("Error: Input file not found: %s\n", *inputPath)
-		return
+	// Flat flags from older versions map to a subcommand
+	if strings.HasPrefix(args[0], "-") && !isHelp(args[0]) {
+		args = legacyArgs(args)
 	}
 
-	// filepath.Base returns the last element of the path
-	base := filepath.Base(*inputPath)
-	// filepath.Ext returns the file extension (e.g. ".mov")
-	ext := filepath.Ext(base)
-	// Remove the original extension
-	name := strings.TrimSuffix(base, ext)
-	// get timestamp
-	ts := time.Now().Format("150405")
-
-	// If no output path specified, derive from input file's base name and add .mp4
-	if *outputPath == "" {
-		// Append the new .mp4 extension
-		*outputPath = fmt.Sprintf("%s_%s.%s",
-			name,
-			ts,
-			strings.TrimPrefix(*outputExtension, "."),
-		)
-	}
-
-	// Create output directory if it doesn't exist
-	outputDir := filepath.Dir(*outputPath)
-	if outputDir != "" {
-		if err := os.MkdirAll(outputDir, 0755); err != nil {
-			fmt.Printf("Error: Failed to create output directory: %v\n", err)
-			return
+	name := args[0]
+	if isHelp(name) || name == "help" {
+		if name == "help" && len(args) > 1 {
+			// "help <command>" prints the flags of the command
+			if c, ok := lookupCommand(args[1]); ok {
+				c.run([]string{"-h"})
+				return exitOK
+			}
 		}
+		printUsage()
+		return exitOK
 	}
-
-	// Create video config
-	resolutionStr, err := config.StringToResolution(*resolution)
-	if err != nil {
-		fmt.Printf("Error: Failed to convert resolution: %v\n", err)
-		return
-	}
-	videoConfig := config.VideoConfig{
-		FfmpegPath:      ffmpegPath,
-		Fps:             *fps,
-		Resolution:      resolutionStr,
-		Bitrate:         *bitrate,
-		Preset:          *preset,
-		Cq:              *cq,
-		Width:           *width,
-		Height:          *height,
-		Encoder:         *encoder,
-		OutputExtension: *outputExtension,
-		Reverse:         *reverse == "true",
+	c, ok := lookupCommand(name)
+	if !ok {
+		names := make([]string, len(commands))
+		for i, c := range commands {
+			names[i] = c.name
+		}
+		fmt.Fprintf(os.Stderr, "Error: unknown command %q%s\n", name, suggestion(name, names))
+		fmt.Fprintln(os.Stderr, "Run 'video_compressor help' for usage.")
+		return exitUsage
 	}
+	return c.run(args[1:])
+}
 
-	// If custom width/height is specified, clear resolution to prevent override
-	if *width != 0 && *height != 0 {
-		videoConfig.Resolution = config.ResolutionNone
-		fmt.Println("Custom width/height specified, ignoring resolution")
+// lookupCommand returns the subcommand with the given name
+func lookupCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
 	}
+	return command{}, false
+}
 
-	// If no custom width/height or resolution is specified, use 1080p
-	if *width == 0 && *height == 0 && videoConfig.Resolution == config.ResolutionNone {
-		videoConfig.Resolution = config.Resolution1080p
-		fmt.Println("No custom width/height or resolution specified, using 1080p")
-	}
+// isHelp reports whether arg asks for help
+func isHelp(arg string) bool {
+	return arg == "-h" || arg == "-help" || arg == "--help"
+}
 
-	// If custom bitrate is specified, use it
-	if *bitrate == 0 && videoConfig.Resolution != config.ResolutionNone {
-		_, _, videoConfig.Bitrate = utils.GetRecommendedSettings(videoConfig.Resolution, 0, 0)
+// printUsage prints the list of subcommands
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: video_compressor <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.summary)
 	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run 'video_compressor <command> -h' for the flags of a command.")
+}
 
-	switch *mode {
-	case "compress":
-		// Compress the video
-		if err := video.CompressVideo(*inputPath, *outputPath, videoConfig, true); err != nil {
-			fmt.Printf("Error: %v\n", err)
-			return
-		}
-	case "merge":
-		// Merge the video
-		if err := video.MergeVideos(*inputPath, *outputPath, videoConfig); err != nil {
-			fmt.Printf("Error: %v\n", err)
-			return
+// legacyArgs converts the flat flags of older versions ("-mode merge -reverse true ...")
+// to subcommand arguments and warns that the form is deprecated
+func legacyArgs(args []string) []string {
+	mode := "compress"
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		switch name {
+		case "mode", "reverse":
+			if !hasValue && i+1 < len(args) {
+				i++
+				value = args[i]
+			}
+			if name == "mode" {
+				mode = value
+			} else {
+				// -reverse took a string value; it is now a boolean flag
+				rest = append(rest, "-reverse="+value)
+			}
+		default:
+			rest = append(rest, args[i])
 		}
 	}
+	fmt.Fprintf(os.Stderr, "Warning: flags without a command are deprecated, use 'video_compressor %s [flags]'\n", mode)
+	return append([]string{mode}, rest...)
 }
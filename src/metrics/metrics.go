@@ -0,0 +1,219 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"video_compressor/src/ffmpeg"
+)
+
+// Namespace prefixes the names of all metrics
+const Namespace = "video_compressor"
+
+// SpeedBuckets are the upper bounds of the encode speed histogram, in multiples of realtime
+var SpeedBuckets = []float64{0.25, 0.5, 1, 2, 4, 8, 16, 32}
+
+// Finished job statuses
+const (
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+// Outcome describes a finished job
+type Outcome struct {
+	Status        string // StatusSucceeded, StatusFailed or StatusCancelled
+	Encoder       string // Video encoder, e.g. hevc_nvenc ("" if nothing was encoded)
+	InputSize     int64
+	OutputSize    int64   // Size of the written output (0 if nothing was written)
+	EncodeSeconds float64 // Processing time
+	Speed         float64 // Media seconds encoded per second (0 if nothing was encoded)
+	FailureReason string  // Reason of a failed FFmpeg run, see ffmpeg.FailureReason ("" otherwise)
+}
+
+// histogram is a Prometheus histogram with SpeedBuckets
+type histogram struct {
+	counts []uint64 // Per bucket, not cumulative; the last one is +Inf
+	sum    float64
+	count  uint64
+}
+
+// Registry collects the metrics of the watch and serve commands. It is safe for
+// concurrent use.
+type Registry struct {
+	mu            sync.Mutex
+	queued        int
+	running       int
+	jobs          map[string]uint64 // Finished jobs by status
+	bytesIn       int64
+	bytesOut      int64
+	encodeSeconds float64
+	speed         map[string]*histogram // By encoder
+	failures      map[string]uint64     // FFmpeg failures by reason
+}
+
+// New returns an empty registry
+func New() *Registry {
+	return &Registry{
+		jobs:     map[string]uint64{StatusSucceeded: 0, StatusFailed: 0, StatusCancelled: 0},
+		speed:    make(map[string]*histogram),
+		failures: make(map[string]uint64),
+	}
+}
+
+// SetQueued sets the number of jobs waiting to be processed
+func (r *Registry) SetQueued(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.queued = n
+}
+
+// AddRunning changes the number of jobs being processed by delta
+func (r *Registry) AddRunning(delta int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.running += delta
+}
+
+// Finished records a finished job
+func (r *Registry) Finished(o Outcome) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.jobs[o.Status]++
+	r.bytesIn += o.InputSize
+	r.bytesOut += o.OutputSize
+	r.encodeSeconds += o.EncodeSeconds
+	if o.FailureReason != "" {
+		r.failures[o.FailureReason]++
+	}
+	if o.Encoder == "" || o.Speed <= 0 {
+		return
+	}
+	h, ok := r.speed[o.Encoder]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(SpeedBuckets)+1)}
+		r.speed[o.Encoder] = h
+	}
+	i := sort.SearchFloat64s(SpeedBuckets, o.Speed)
+	h.counts[i]++
+	h.sum += o.Speed
+	h.count++
+}
+
+// Write writes the metrics in the Prometheus text exposition format
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var b strings.Builder
+
+	header(&b, "jobs_queued", "gauge", "Jobs waiting to be processed.")
+	sample(&b, "jobs_queued", nil, float64(r.queued))
+	header(&b, "jobs_running", "gauge", "Jobs being processed.")
+	sample(&b, "jobs_running", nil, float64(r.running))
+	header(&b, "jobs_total", "counter", "Finished jobs by status.")
+	for _, status := range sortedKeys(r.jobs) {
+		sample(&b, "jobs_total", []string{"status", status}, float64(r.jobs[status]))
+	}
+	header(&b, "input_bytes_total", "counter", "Size of the inputs of finished jobs.")
+	sample(&b, "input_bytes_total", nil, float64(r.bytesIn))
+	header(&b, "output_bytes_total", "counter", "Size of the outputs written.")
+	sample(&b, "output_bytes_total", nil, float64(r.bytesOut))
+	header(&b, "encode_seconds_total", "counter", "Time spent processing finished jobs.")
+	sample(&b, "encode_seconds_total", nil, r.encodeSeconds)
+
+	header(&b, "encode_speed", "histogram", "Encode speed in multiples of realtime by video encoder.")
+	for _, encoder := range sortedKeys(r.speed) {
+		h := r.speed[encoder]
+		var cumulative uint64
+		for i, bound := range SpeedBuckets {
+			cumulative += h.counts[i]
+			sample(&b, "encode_speed_bucket", []string{"encoder", encoder, "le", formatFloat(bound)}, float64(cumulative))
+		}
+		sample(&b, "encode_speed_bucket", []string{"encoder", encoder, "le", "+Inf"}, float64(h.count))
+		sample(&b, "encode_speed_sum", []string{"encoder", encoder}, h.sum)
+		sample(&b, "encode_speed_count", []string{"encoder", encoder}, float64(h.count))
+	}
+
+	header(&b, "ffmpeg_failures_total", "counter", "Failed FFmpeg runs by reason.")
+	for _, reason := range sortedKeys(r.failures) {
+		sample(&b, "ffmpeg_failures_total", []string{"reason", reason}, float64(r.failures[reason]))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// ServeHTTP serves the metrics
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.Write(w)
+}
+
+// HealthHandler returns a handler that responds 200 if the FFmpeg binary at ffmpegPath
+// runs, 503 otherwise
+func HealthHandler(ffmpegPath string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if err := ffmpeg.CheckRunnable(ctx, ffmpegPath); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, err)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+}
+
+// Register adds the /metrics and /healthz endpoints to mux
+func Register(mux *http.ServeMux, r *Registry, ffmpegPath string) {
+	mux.Handle("GET /metrics", r)
+	mux.Handle("GET /healthz", HealthHandler(ffmpegPath))
+}
+
+// header writes the HELP and TYPE lines of a metric
+func header(b *strings.Builder, name, kind, help string) {
+	fmt.Fprintf(b, "# HELP %s_%s %s\n# TYPE %s_%s %s\n", Namespace, name, help, Namespace, name, kind)
+}
+
+// sample writes a sample line; labels alternate names and values
+func sample(b *strings.Builder, name string, labels []string, value float64) {
+	b.WriteString(Namespace + "_" + name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i := 0; i < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(b, "%s=\"%s\"", labels[i], escapeLabel(labels[i+1]))
+		}
+		b.WriteByte('}')
+	}
+	b.WriteString(" " + formatFloat(value) + "\n")
+}
+
+// escapeLabel escapes a label value for the text format
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// formatFloat formats a sample value or bucket bound
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
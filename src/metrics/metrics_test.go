@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"video_compressor/src/ffmpeg"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	r := New()
+	r.SetQueued(2)
+	r.AddRunning(1)
+	r.Finished(Outcome{Status: StatusSucceeded, Encoder: "hevc_nvenc", InputSize: 1000, OutputSize: 400, EncodeSeconds: 10, Speed: 4})
+	r.Finished(Outcome{Status: StatusSucceeded, Encoder: "hevc_nvenc", InputSize: 500, OutputSize: 100, EncodeSeconds: 5, Speed: 40})
+	r.Finished(Outcome{Status: StatusFailed, InputSize: 300, EncodeSeconds: 1, FailureReason: "gpu_unavailable"})
+
+	var b strings.Builder
+	if err := r.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"# TYPE video_compressor_jobs_queued gauge\nvideo_compressor_jobs_queued 2\n",
+		"video_compressor_jobs_running 1\n",
+		`video_compressor_jobs_total{status="cancelled"} 0` + "\n",
+		`video_compressor_jobs_total{status="succeeded"} 2` + "\n",
+		"video_compressor_input_bytes_total 1800\n",
+		"video_compressor_output_bytes_total 500\n",
+		"video_compressor_encode_seconds_total 16\n",
+		`video_compressor_encode_speed_bucket{encoder="hevc_nvenc",le="2"} 0` + "\n",
+		`video_compressor_encode_speed_bucket{encoder="hevc_nvenc",le="4"} 1` + "\n",
+		`video_compressor_encode_speed_bucket{encoder="hevc_nvenc",le="+Inf"} 2` + "\n",
+		`video_compressor_encode_speed_sum{encoder="hevc_nvenc"} 44` + "\n",
+		`video_compressor_ffmpeg_failures_total{reason="gpu_unavailable"} 1` + "\n",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("output does not contain %q:\n%s", want, b.String())
+		}
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	fake := &ffmpeg.FakeRunner{}
+	original := ffmpeg.DefaultRunner
+	ffmpeg.DefaultRunner = fake
+	defer func() { ffmpeg.DefaultRunner = original }()
+
+	check := func() (int, string) {
+		rec := httptest.NewRecorder()
+		HealthHandler("ffmpeg").ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		body, _ := io.ReadAll(rec.Body)
+		return rec.Code, string(body)
+	}
+	if code, body := check(); code != http.StatusOK || body != "ok\n" {
+		t.Errorf("healthy: %d %q", code, body)
+	}
+	if calls := fake.Calls(); len(calls) != 1 || strings.Join(calls[0].Args, " ") != "-version" {
+		t.Errorf("calls = %+v, want ffmpeg -version", calls)
+	}
+
+	fake.Handler = func(inv ffmpeg.Invocation, stdout, stderr io.Writer) error {
+		return errors.New("exec: no such file")
+	}
+	if code, body := check(); code != http.StatusServiceUnavailable || !strings.Contains(body, "not runnable") {
+		t.Errorf("unhealthy: %d %q", code, body)
+	}
+}
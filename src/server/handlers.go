@@ -0,0 +1,463 @@
+package server
+
+import (
+	"crypto/rand"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"video_compressor/src/config"
+	"video_compressor/src/ffmpeg"
+	"video_compressor/src/jobs"
+	"video_compressor/src/metrics"
+)
+
+// indexPage is the web page for uploading videos and following their jobs
+//
+//go:embed web/index.html
+var indexPage []byte
+
+// maxUploadMemory is the part of an upload kept in memory; the rest goes to a temporary file
+const maxUploadMemory = 32 << 20
+
+// maxRequestBody is the largest accepted JSON submission
+const maxRequestBody = 1 << 20
+
+// eventFallback is how often an event stream rereads a job that did not report a change,
+// e.g. because it was cancelled by another process
+const eventFallback = 5 * time.Second
+
+// submitRequest is the JSON body of a job submission for a file on the server
+type submitRequest struct {
+	Input   string          `json:"input"`   // Path of the input on the server
+	Profile string          `json:"profile"` // Named settings profile
+	Config  json.RawMessage `json:"config"`  // Inline settings, e.g. {"cq": 28}
+}
+
+// jobView is a job as returned by the API
+type jobView struct {
+	jobs.Job
+	Progress Progress `json:"progress"`
+}
+
+// routes registers the web page, the API and the metrics endpoints
+func (s *Server) routes() {
+	s.mux.HandleFunc("GET /{$}", s.handleIndex)
+	s.mux.HandleFunc("GET /api/profiles", s.handleProfiles)
+	s.mux.HandleFunc("POST /api/jobs", sameSite(s.handleSubmit))
+	s.mux.HandleFunc("GET /api/jobs", s.handleList)
+	s.mux.HandleFunc("GET /api/jobs/{id}", s.handleGet)
+	s.mux.HandleFunc("POST /api/jobs/{id}/cancel", sameSite(s.handleCancel))
+	s.mux.HandleFunc("GET /api/events", s.handleAllEvents)
+	s.mux.HandleFunc("GET /api/jobs/{id}/events", s.handleEvents)
+	s.mux.HandleFunc("GET /api/jobs/{id}/output", s.handleOutput)
+	if s.opts.Metrics != nil {
+		metrics.Register(s.mux, s.opts.Metrics, s.opts.FfmpegPath)
+	}
+}
+
+// handleIndex serves the web page
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(indexPage)
+}
+
+// handleProfiles returns the names of the profiles jobs can use
+func (s *Server) handleProfiles(w http.ResponseWriter, r *http.Request) {
+	profiles := s.opts.Profiles
+	if profiles == nil {
+		profiles = []string{}
+	}
+	writeJSON(w, http.StatusOK, profiles)
+}
+
+// handleSubmit queues a job for an uploaded file (multipart form with "file", "profile"
+// and "config" fields) or for a file on the server (JSON submitRequest). Other content
+// types are rejected with 415; bodies larger than the upload limit, or than
+// maxRequestBody for JSON, with 413.
+func (s *Server) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	var req submitRequest
+	var upload string
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "multipart/form-data":
+		r.Body = http.MaxBytesReader(w, r.Body, s.opts.MaxUpload)
+		var status int
+		var err error
+		if upload, status, err = s.saveUpload(r); err != nil {
+			writeError(w, status, err.Error())
+			return
+		}
+		req.Input, req.Profile = upload, r.FormValue("profile")
+		if c := r.FormValue("config"); c != "" {
+			req.Config = json.RawMessage(c)
+		}
+	case "application/json":
+		r.Body = http.MaxBytesReader(w, r.Body, maxRequestBody)
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, bodyErrorStatus(err), fmt.Sprintf("invalid request: %v", err))
+			return
+		}
+	default:
+		writeError(w, http.StatusUnsupportedMediaType, "expected an application/json or multipart/form-data request")
+		return
+	}
+
+	job, status, err := s.submit(req)
+	if err != nil {
+		if upload != "" {
+			os.RemoveAll(filepath.Dir(upload))
+		}
+		writeError(w, status, err.Error())
+		return
+	}
+	w.Header().Set("Location", "/api/jobs/"+job.ID)
+	s.writeJob(w, http.StatusCreated, job)
+}
+
+// submit validates a submission, stores the job and queues it
+func (s *Server) submit(req submitRequest) (jobs.Job, int, error) {
+	input, err := filepath.Abs(strings.TrimSpace(req.Input))
+	if err != nil || req.Input == "" {
+		return jobs.Job{}, http.StatusBadRequest, fmt.Errorf("an input file is required")
+	}
+	if info, err := os.Stat(input); err != nil || info.IsDir() {
+		return jobs.Job{}, http.StatusBadRequest, fmt.Errorf("input not found: %s", req.Input)
+	}
+	if !ffmpeg.IsSupportedFormat(input) {
+		return jobs.Job{}, http.StatusBadRequest, fmt.Errorf("unsupported input format; supported: %v", ffmpeg.SupportedFormatsKeys())
+	}
+	settings := config.Settings{}
+	if len(req.Config) > 0 && string(req.Config) != "null" {
+		if settings, err = config.ParseSettings(req.Config); err != nil {
+			return jobs.Job{}, http.StatusBadRequest, err
+		}
+	}
+	cfg, err := s.opts.Resolve(req.Profile, settings)
+	if err != nil {
+		return jobs.Job{}, http.StatusBadRequest, err
+	}
+
+	job, err := s.opts.Store.Add(jobs.Job{Input: input, Config: cfg, ConfigHash: jobs.ConfigHash(cfg), Status: jobs.StatusQueued})
+	if err != nil {
+		return jobs.Job{}, http.StatusInternalServerError, err
+	}
+	// Every job gets its own output folder, so outputs of inputs with the same name do not clash
+	dir := filepath.Join(s.opts.DataDir, OutputsDir, job.ID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return jobs.Job{}, http.StatusInternalServerError, fmt.Errorf("failed to create output directory: %v", err)
+	}
+	name := filepath.Base(input)
+	job, err = s.opts.Store.Update(job.ID, func(j *jobs.Job) error {
+		j.Output = filepath.Join(dir, strings.TrimSuffix(name, filepath.Ext(name)))
+		return nil
+	})
+	if err != nil {
+		return jobs.Job{}, http.StatusInternalServerError, err
+	}
+	s.enqueue(job.ID)
+	s.notify()
+	return job, http.StatusCreated, nil
+}
+
+// saveUpload stores the "file" field of a multipart form in its own folder of the
+// uploads directory and returns its path, or the status code of the failure
+func (s *Server) saveUpload(r *http.Request) (string, int, error) {
+	if err := r.ParseMultipartForm(maxUploadMemory); err != nil {
+		return "", bodyErrorStatus(err), fmt.Errorf("invalid upload: %v", err)
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		return "", http.StatusBadRequest, fmt.Errorf("invalid upload: %v", err)
+	}
+	defer file.Close()
+	name := filepath.Base(filepath.Clean("/" + strings.ReplaceAll(header.Filename, "\\", "/")))
+	if name == "/" || strings.HasPrefix(name, ".") {
+		return "", http.StatusBadRequest, fmt.Errorf("invalid upload file name: %q", header.Filename)
+	}
+
+	dir := filepath.Join(s.opts.DataDir, UploadsDir, randomName())
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", http.StatusInternalServerError, fmt.Errorf("failed to store upload: %v", err)
+	}
+	path := filepath.Join(dir, name)
+	out, err := os.Create(path)
+	if err != nil {
+		return "", http.StatusInternalServerError, fmt.Errorf("failed to store upload: %v", err)
+	}
+	_, err = io.Copy(out, file)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", http.StatusInternalServerError, fmt.Errorf("failed to store upload: %v", err)
+	}
+	return path, http.StatusCreated, nil
+}
+
+// handleList returns the jobs, filtered by the comma-separated "status" query parameter
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	filter := make(map[jobs.Status]bool)
+	if statuses := r.URL.Query().Get("status"); statuses != "" {
+		for _, name := range strings.Split(statuses, ",") {
+			status, err := jobs.StringToStatus(strings.TrimSpace(name))
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			filter[status] = true
+		}
+	}
+	list, err := s.opts.Store.List()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	views := []jobView{}
+	for _, job := range list {
+		if s.owns(job) && (len(filter) == 0 || filter[job.Status]) {
+			p, _ := s.progress(job)
+			views = append(views, jobView{Job: job, Progress: p})
+		}
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+// handleGet returns a job with its progress
+func (s *Server) handleGet(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.lookup(w, r)
+	if ok {
+		s.writeJob(w, http.StatusOK, job)
+	}
+}
+
+// handleCancel cancels a queued or running job
+func (s *Server) handleCancel(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	job, err := s.cancel(job.ID)
+	if err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	s.writeJob(w, http.StatusOK, job)
+}
+
+// handleEvents streams the progress of a job as Server-Sent Events: "progress" events
+// with a Progress whenever it changes and a final "done" event with the finished job
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	flusher, ok := startEvents(w)
+	if !ok {
+		return
+	}
+
+	var last Progress
+	for first := true; ; first = false {
+		changed := s.changes()
+		if !first {
+			var err error
+			if job, err = s.opts.Store.Get(job.ID); err != nil {
+				return
+			}
+		}
+		p, running := s.progress(job)
+		if p != last {
+			writeEvent(w, "progress", p)
+			last = p
+		}
+		if job.Status.Finished() && !running {
+			writeEvent(w, "done", jobView{Job: job, Progress: p})
+			flusher.Flush()
+			return
+		}
+		flusher.Flush()
+		select {
+		case <-r.Context().Done():
+			return
+		case <-changed:
+		case <-time.After(eventFallback):
+		}
+	}
+}
+
+// handleAllEvents streams a "job" event for every job when it starts and for every job
+// that changes afterwards, so a client follows all jobs over a single connection
+func (s *Server) handleAllEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := startEvents(w)
+	if !ok {
+		return
+	}
+
+	// The state of each job as last sent
+	type state struct {
+		status   jobs.Status
+		updated  int64 // Unix nanoseconds; time.Time locations differ between loads
+		progress Progress
+	}
+	sent := make(map[string]state)
+	for {
+		changed := s.changes()
+		list, err := s.opts.Store.List()
+		if err != nil {
+			return
+		}
+		for _, job := range list {
+			if !s.owns(job) {
+				continue
+			}
+			p, _ := s.progress(job)
+			current := state{job.Status, job.Updated().UnixNano(), p}
+			if last, ok := sent[job.ID]; ok && last == current {
+				continue
+			}
+			writeEvent(w, "job", jobView{Job: job, Progress: p})
+			sent[job.ID] = current
+		}
+		flusher.Flush()
+		select {
+		case <-r.Context().Done():
+			return
+		case <-changed:
+		case <-time.After(eventFallback):
+		}
+	}
+}
+
+// handleOutput sends the output file of a succeeded job
+func (s *Server) handleOutput(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	switch {
+	case !job.Status.Finished():
+		writeError(w, http.StatusConflict, fmt.Sprintf("job %s is %s", job.ID, job.Status))
+		return
+	case job.Status != jobs.StatusSucceeded:
+		writeError(w, http.StatusNotFound, fmt.Sprintf("job %s %s: %s", job.ID, job.Status, job.Error))
+		return
+	case job.Written == "":
+		writeError(w, http.StatusNotFound, fmt.Sprintf("job %s wrote no output (%s)", job.ID, job.Decision))
+		return
+	}
+	f, err := os.Open(job.Written)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "output no longer exists")
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	name := filepath.Base(job.Written)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+// lookup returns the job named by the "id" path parameter, writing a 404 if there is none
+// or it belongs to another process sharing the job history
+func (s *Server) lookup(w http.ResponseWriter, r *http.Request) (jobs.Job, bool) {
+	job, err := s.opts.Store.Get(r.PathValue("id"))
+	if err == nil && !s.owns(job) {
+		err = fmt.Errorf("job not found: %s", job.ID)
+	}
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return jobs.Job{}, false
+	}
+	return job, true
+}
+
+// sameSite rejects requests sent by pages of other sites with 403, so that a web page
+// cannot submit or cancel jobs through the browser of a user of the server. Browsers
+// send Sec-Fetch-Site, or at least Origin; clients such as curl send neither and pass.
+func sameSite(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if site := r.Header.Get("Sec-Fetch-Site"); site != "" {
+			if site != "same-origin" && site != "none" {
+				writeError(w, http.StatusForbidden, "cross-site request rejected")
+				return
+			}
+		} else if origin := r.Header.Get("Origin"); origin != "" {
+			if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+				writeError(w, http.StatusForbidden, "cross-site request rejected")
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// writeJob writes a job with its progress
+func (s *Server) writeJob(w http.ResponseWriter, status int, job jobs.Job) {
+	p, _ := s.progress(job)
+	writeJSON(w, status, jobView{Job: job, Progress: p})
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error response {"error": message}
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// bodyErrorStatus returns 413 if reading a request body failed because it exceeded its
+// limit, 400 otherwise
+func bodyErrorStatus(err error) int {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// startEvents starts a Server-Sent Events response, or reports an error if the
+// connection cannot stream
+func startEvents(w http.ResponseWriter) (http.Flusher, bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return nil, false
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	return flusher, true
+}
+
+// writeEvent writes a Server-Sent Event with v as JSON data
+func writeEvent(w io.Writer, event string, v any) {
+	data, _ := json.Marshal(v)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+}
+
+// randomName returns a random folder name
+func randomName() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,316 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"video_compressor/src/config"
+	"video_compressor/src/ffmpeg"
+	"video_compressor/src/jobs"
+	"video_compressor/src/metrics"
+	"video_compressor/src/utils"
+	"video_compressor/src/video"
+)
+
+// Folders of the data directory
+const (
+	UploadsDir = "uploads"
+	OutputsDir = "outputs"
+)
+
+// DefaultMaxUpload is the largest accepted upload unless Options.MaxUpload is set
+const DefaultMaxUpload = 4 << 30
+
+// Options configures a Server
+type Options struct {
+	Store   *jobs.Store
+	DataDir string // Uploaded inputs and outputs are stored here
+	Workers int    // Jobs processed at the same time
+	Verbose bool   // Print the FFmpeg output of the jobs
+
+	// MaxUpload is the largest accepted upload in bytes, DefaultMaxUpload if 0
+	MaxUpload int64
+
+	// Metrics, if set, records the jobs and is served on /metrics with an FFmpeg
+	// health check on /healthz
+	Metrics    *metrics.Registry
+	FfmpegPath string
+
+	// Profiles lists the profiles offered by the web page
+	Profiles []string
+
+	// Resolve returns the settings of a submitted job from a profile and inline settings
+	Resolve func(profile string, settings config.Settings) (config.VideoConfig, error)
+}
+
+// Progress is the state of a job sent to event stream subscribers
+type Progress struct {
+	ID       string      `json:"id"`
+	Status   jobs.Status `json:"status"`
+	Percent  float64     `json:"percent"`  // 0 to 100, 0 while the duration is unknown
+	Time     float64     `json:"time"`     // Seconds of media encoded
+	Duration float64     `json:"duration"` // Source duration in seconds, 0 if unknown
+	Speed    float64     `json:"speed"`
+}
+
+// active is a job being processed by a worker
+type active struct {
+	cancel   context.CancelFunc
+	progress Progress
+}
+
+// Server runs submitted jobs with a pool of workers and serves the REST API
+type Server struct {
+	opts Options
+	mux  *http.ServeMux
+	run  func(ctx context.Context, job jobs.Job) (*video.Result, error) // Processes a job; replaced in tests
+
+	mu      sync.Mutex
+	pending []string           // IDs of queued jobs in submission order
+	active  map[string]*active // By job ID
+	changed chan struct{}      // Closed and replaced whenever a job changes
+	wake    chan struct{}      // Signals idle workers that a job was queued
+	wg      sync.WaitGroup
+}
+
+// New returns a server storing its files in opts.DataDir
+func New(opts Options) (*Server, error) {
+	if opts.Store == nil || opts.Resolve == nil {
+		return nil, fmt.Errorf("a job store and a settings resolver are required")
+	}
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+	if opts.MaxUpload <= 0 {
+		opts.MaxUpload = DefaultMaxUpload
+	}
+	for _, dir := range []string{UploadsDir, OutputsDir} {
+		if err := os.MkdirAll(filepath.Join(opts.DataDir, dir), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create data directory: %v", err)
+		}
+	}
+	s := &Server{
+		opts:    opts,
+		mux:     http.NewServeMux(),
+		active:  make(map[string]*active),
+		changed: make(chan struct{}),
+		wake:    make(chan struct{}, 1),
+	}
+	s.run = s.runJob
+	s.routes()
+	return s, nil
+}
+
+// Handler returns the HTTP handler of the API
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+// Start queues the jobs of this server left queued by a previous run and starts the
+// workers. Cancelling ctx stops them; jobs interrupted that way are queued again for the
+// next start. Jobs of this server still marked running were interrupted by a crash and
+// are queued again too.
+func (s *Server) Start(ctx context.Context) error {
+	list, err := s.opts.Store.List()
+	if err != nil {
+		return err
+	}
+	for _, job := range list {
+		if job.Status == jobs.StatusRunning && s.owns(job) {
+			if job, err = s.opts.Store.Update(job.ID, func(j *jobs.Job) error {
+				j.Status, j.Error, j.Finished = jobs.StatusQueued, "", time.Time{}
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+		if job.Status == jobs.StatusQueued && s.owns(job) {
+			s.enqueue(job.ID)
+		}
+	}
+	for i := 0; i < s.opts.Workers; i++ {
+		s.wg.Add(1)
+		go s.work(ctx)
+	}
+	return nil
+}
+
+// owns reports whether the job was submitted to a server with this data directory. Jobs
+// of other processes sharing the job history are left alone.
+func (s *Server) owns(job jobs.Job) bool {
+	rel, err := filepath.Rel(filepath.Join(s.opts.DataDir, OutputsDir), job.Output)
+	return err == nil && rel != "." && !strings.HasPrefix(rel, "..")
+}
+
+// Wait waits for the workers to stop after the context of Start was cancelled
+func (s *Server) Wait() {
+	s.wg.Wait()
+}
+
+// enqueue adds a queued job for the workers
+func (s *Server) enqueue(id string) {
+	s.mu.Lock()
+	s.pending = append(s.pending, id)
+	s.setQueued()
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next removes the oldest pending job, "" if there is none
+func (s *Server) next() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.pending) == 0 {
+		return ""
+	}
+	id := s.pending[0]
+	s.pending = s.pending[1:]
+	s.setQueued()
+	if len(s.pending) > 0 {
+		// Let another idle worker take the rest
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+	return id
+}
+
+// setQueued updates the queued jobs metric; s.mu must be held
+func (s *Server) setQueued() {
+	if s.opts.Metrics != nil {
+		s.opts.Metrics.SetQueued(len(s.pending))
+	}
+}
+
+// work processes pending jobs until ctx is cancelled
+func (s *Server) work(ctx context.Context) {
+	defer s.wg.Done()
+	for {
+		if id := s.next(); id != "" {
+			s.process(ctx, id)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		}
+	}
+}
+
+// process runs one job, unless it was cancelled while queued
+func (s *Server) process(ctx context.Context, id string) {
+	if ctx.Err() != nil {
+		return
+	}
+	job, err := s.opts.Store.Get(id)
+	if err != nil || job.Status != jobs.StatusQueued {
+		return
+	}
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	a := &active{cancel: cancel, progress: Progress{ID: id, Status: jobs.StatusRunning}}
+	if info, err := utils.ProbeVideo(ctx, job.Input); err == nil {
+		a.progress.Duration = info.Duration
+	}
+	s.mu.Lock()
+	s.active[id] = a
+	s.mu.Unlock()
+	s.notify()
+
+	jobCtx = video.WithProgress(jobCtx, func(p ffmpeg.Progress) {
+		s.mu.Lock()
+		a.progress.Time, a.progress.Speed = p.Time, p.Speed
+		if a.progress.Duration > 0 {
+			a.progress.Percent = min(100, p.Time/a.progress.Duration*100)
+		}
+		s.mu.Unlock()
+		s.notify()
+	})
+	if s.opts.Metrics != nil {
+		s.opts.Metrics.AddRunning(1)
+	}
+	result, err := s.run(jobCtx, job)
+	if err != nil {
+		fmt.Printf("❌ Job %s failed: %v\n", id, err)
+	}
+	if s.opts.Metrics != nil {
+		s.opts.Metrics.AddRunning(-1)
+		// Jobs interrupted by the shutdown run again and are counted then
+		if ctx.Err() == nil {
+			s.opts.Metrics.Finished(video.Outcome(result, err, jobCtx.Err() != nil))
+		}
+	}
+	if ctx.Err() != nil {
+		// Interrupted by the shutdown, not by the user: run it again after a restart
+		s.opts.Store.Update(id, func(j *jobs.Job) error {
+			j.Status, j.Error, j.Finished = jobs.StatusQueued, "", time.Time{}
+			return nil
+		})
+	}
+
+	s.mu.Lock()
+	delete(s.active, id)
+	s.mu.Unlock()
+	s.notify()
+}
+
+// runJob compresses the input of a job and records the outcome in the store
+func (s *Server) runJob(ctx context.Context, job jobs.Job) (*video.Result, error) {
+	return video.RunJob(ctx, s.opts.Store, job, s.opts.Verbose)
+}
+
+// cancel cancels a job in the store and stops it if a worker is processing it
+func (s *Server) cancel(id string) (jobs.Job, error) {
+	job, err := s.opts.Store.Cancel(id)
+	if err != nil {
+		return job, err
+	}
+	s.mu.Lock()
+	if a, ok := s.active[id]; ok {
+		a.cancel()
+	}
+	s.mu.Unlock()
+	s.notify()
+	return job, nil
+}
+
+// notify wakes the event streams waiting for a change
+func (s *Server) notify() {
+	s.mu.Lock()
+	close(s.changed)
+	s.changed = make(chan struct{})
+	s.mu.Unlock()
+}
+
+// changes returns a channel that is closed on the next change
+func (s *Server) changes() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.changed
+}
+
+// progress returns the progress of a job and whether a worker is processing it
+func (s *Server) progress(job jobs.Job) (Progress, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if a, ok := s.active[job.ID]; ok && !job.Status.Finished() {
+		return a.progress, true
+	}
+	p := Progress{ID: job.ID, Status: job.Status}
+	if job.Status == jobs.StatusSucceeded {
+		p.Percent = 100
+	}
+	return p, false
+}
@@ -0,0 +1,471 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"video_compressor/src/config"
+	"video_compressor/src/jobs"
+	"video_compressor/src/metrics"
+	"video_compressor/src/video"
+)
+
+// newTestServer returns a server whose jobs write a fixed output, or wait until they
+// are cancelled if their CQ is 99
+func newTestServer(t *testing.T) (*Server, *httptest.Server) {
+	dir := t.TempDir()
+	store, err := jobs.Open(filepath.Join(dir, "jobs.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(Options{Store: store, DataDir: dir, Metrics: metrics.New(), FfmpegPath: "ffmpeg", Resolve: func(profile string, settings config.Settings) (config.VideoConfig, error) {
+		cq, err := strconv.Atoi(settings["cq"])
+		if err != nil {
+			return config.VideoConfig{}, fmt.Errorf("invalid cq")
+		}
+		return config.VideoConfig{Cq: cq, OutputExtension: ".mp4"}, nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.run = func(ctx context.Context, job jobs.Job) (*video.Result, error) {
+		if _, err := store.Start(job); err != nil {
+			return nil, err
+		}
+		result := &video.Result{Input: job.Input, Decision: video.DecisionEncoded, InputSize: 14, OutputSize: 5,
+			Output: job.Output + ".mp4", Encoder: "libx264", WallTime: 2, Speed: 1.5}
+		status := jobs.StatusSucceeded
+		var err error
+		if job.Config.Cq == 99 {
+			<-ctx.Done()
+			status, result.Output, err = jobs.StatusCancelled, "", ctx.Err()
+		} else if err := os.WriteFile(result.Output, []byte("small"), 0644); err != nil {
+			return nil, err
+		}
+		if _, err := store.Update(job.ID, func(j *jobs.Job) error {
+			j.Status, j.Written = status, result.Output
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+		return result, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := s.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(func() {
+		ts.Close()
+		cancel()
+		s.Wait()
+	})
+	return s, ts
+}
+
+// decodeJob decodes a job response and checks its status code
+func decodeJob(t *testing.T, resp *http.Response, err error, wantStatus int) jobView {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != wantStatus {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("status = %d (%s), want %d", resp.StatusCode, body, wantStatus)
+	}
+	var view jobView
+	if err := json.NewDecoder(resp.Body).Decode(&view); err != nil {
+		t.Fatal(err)
+	}
+	return view
+}
+
+// waitDone reads the event stream of a job until its "done" event
+func waitDone(t *testing.T, url string) jobView {
+	t.Helper()
+	resp, err := http.Get(url + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	scanner := bufio.NewScanner(resp.Body)
+	event := ""
+	for scanner.Scan() {
+		line := scanner.Text()
+		if name, ok := strings.CutPrefix(line, "event: "); ok {
+			event = name
+		} else if data, ok := strings.CutPrefix(line, "data: "); ok && event == "done" {
+			var view jobView
+			if err := json.Unmarshal([]byte(data), &view); err != nil {
+				t.Fatal(err)
+			}
+			return view
+		}
+	}
+	t.Fatalf("event stream ended without a done event: %v", scanner.Err())
+	return jobView{}
+}
+
+func TestServerUpload(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", "holiday.mp4")
+	part.Write([]byte("original video"))
+	form.WriteField("config", `{"cq": 28}`)
+	form.Close()
+	resp, err := http.Post(ts.URL+"/api/jobs", form.FormDataContentType(), &body)
+	job := decodeJob(t, resp, err, http.StatusCreated)
+	if job.Config.Cq != 28 || filepath.Base(job.Input) != "holiday.mp4" {
+		t.Errorf("job = %+v, want the upload with cq 28", job.Job)
+	}
+
+	done := waitDone(t, ts.URL+"/api/jobs/"+job.ID)
+	if done.Status != jobs.StatusSucceeded || done.Progress.Percent != 100 {
+		t.Fatalf("done = %+v, want succeeded", done)
+	}
+	resp, err = http.Get(ts.URL + "/api/jobs/" + job.ID + "/output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(output) != "small" || !strings.Contains(resp.Header.Get("Content-Disposition"), "holiday.mp4") {
+		t.Errorf("output = %q, %q", output, resp.Header.Get("Content-Disposition"))
+	}
+}
+
+func TestServerCancel(t *testing.T) {
+	_, ts := newTestServer(t)
+	input := filepath.Join(t.TempDir(), "long.mkv")
+	if err := os.WriteFile(input, []byte("original video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Post(ts.URL+"/api/jobs", "application/json", strings.NewReader(fmt.Sprintf(`{"input": %q, "config": {"cq": 99}}`, input)))
+	job := decodeJob(t, resp, err, http.StatusCreated)
+	url := ts.URL + "/api/jobs/" + job.ID
+	for deadline := time.Now().Add(5 * time.Second); job.Progress.Status != jobs.StatusRunning; {
+		if time.Now().After(deadline) {
+			t.Fatalf("job did not start: %+v", job)
+		}
+		time.Sleep(10 * time.Millisecond)
+		resp, err := http.Get(url)
+		job = decodeJob(t, resp, err, http.StatusOK)
+	}
+	resp, err = http.Get(url + "/output")
+	if err != nil || resp.StatusCode != http.StatusConflict {
+		t.Errorf("output of a running job = %v, %v, want 409", resp.StatusCode, err)
+	}
+
+	resp, err = http.Post(url+"/cancel", "", nil)
+	decodeJob(t, resp, err, http.StatusOK)
+	if done := waitDone(t, url); done.Status != jobs.StatusCancelled {
+		t.Errorf("status = %s, want cancelled", done.Status)
+	}
+	resp, err = http.Post(url+"/cancel", "", nil)
+	if err != nil || resp.StatusCode != http.StatusConflict {
+		t.Errorf("second cancel = %v, %v, want 409", resp.StatusCode, err)
+	}
+
+	resp, err = http.Get(ts.URL + "/api/jobs?status=cancelled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list []jobView
+	json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	if len(list) != 1 || list[0].ID != job.ID {
+		t.Errorf("cancelled jobs = %+v, want %s", list, job.ID)
+	}
+}
+
+func TestServerMetrics(t *testing.T) {
+	_, ts := newTestServer(t)
+	input := filepath.Join(t.TempDir(), "a.mp4")
+	if err := os.WriteFile(input, []byte("original video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(ts.URL+"/api/jobs", "application/json", strings.NewReader(fmt.Sprintf(`{"input": %q, "config": {"cq": 28}}`, input)))
+	job := decodeJob(t, resp, err, http.StatusCreated)
+	waitDone(t, ts.URL+"/api/jobs/"+job.ID)
+
+	// The worker records the outcome after the job is finished in the store
+	var body []byte
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		resp, err := http.Get(ts.URL + "/metrics")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if bytes.Contains(body, []byte(`video_compressor_jobs_total{status="succeeded"} 1`)) || time.Now().After(deadline) {
+			break
+		}
+	}
+	for _, want := range []string{
+		`video_compressor_jobs_total{status="succeeded"} 1`,
+		`video_compressor_jobs_running 0`,
+		`video_compressor_output_bytes_total 5`,
+		`video_compressor_encode_speed_bucket{encoder="libx264",le="1"} 0`,
+		`video_compressor_encode_speed_bucket{encoder="libx264",le="2"} 1`,
+	} {
+		if !bytes.Contains(body, []byte(want)) {
+			t.Errorf("metrics do not contain %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestServerRejects(t *testing.T) {
+	_, ts := newTestServer(t)
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"missing input", `{"config": {"cq": 28}}`, http.StatusBadRequest},
+		{"unsupported format", `{"input": "server_test.go"}`, http.StatusBadRequest},
+		{"invalid json", `{"input":`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		resp, err := http.Post(ts.URL+"/api/jobs", "application/json", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, resp.StatusCode, tt.want)
+		}
+	}
+	resp, err := http.Get(ts.URL + "/api/jobs/unknown")
+	if err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown job = %v, %v, want 404", resp.StatusCode, err)
+	}
+}
+
+func TestServerRejectsCrossSite(t *testing.T) {
+	_, ts := newTestServer(t)
+	input := filepath.Join(t.TempDir(), "a.mp4")
+	if err := os.WriteFile(input, []byte("original video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	body := fmt.Sprintf(`{"input": %q, "config": {"cq": 28}}`, input)
+	tests := []struct {
+		name        string
+		contentType string
+		header      string
+		value       string
+		want        int
+	}{
+		{"form post", "text/plain", "", "", http.StatusUnsupportedMediaType},
+		{"cross-site fetch", "application/json", "Sec-Fetch-Site", "cross-site", http.StatusForbidden},
+		{"same-site fetch", "application/json", "Sec-Fetch-Site", "same-site", http.StatusForbidden},
+		{"other origin", "application/json", "Origin", "http://evil.example", http.StatusForbidden},
+		{"same origin", "application/json", "Origin", ts.URL, http.StatusCreated},
+		{"same-origin fetch", "application/json", "Sec-Fetch-Site", "same-origin", http.StatusCreated},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/api/jobs", strings.NewReader(body))
+		req.Header.Set("Content-Type", tt.contentType)
+		if tt.header != "" {
+			req.Header.Set(tt.header, tt.value)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, resp.StatusCode, tt.want)
+		}
+	}
+}
+
+func TestServerOnlyShowsOwnJobs(t *testing.T) {
+	s, ts := newTestServer(t)
+	// A job of compress sharing the job history
+	other, err := s.opts.Store.Add(jobs.Job{Input: "/in/a.mp4", Output: "/out/a", Status: jobs.StatusRunning})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Get(ts.URL + "/api/jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list []jobView
+	json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	if len(list) != 0 {
+		t.Errorf("jobs = %+v, want none", list)
+	}
+	for _, path := range []string{"", "/output", "/events"} {
+		resp, err := http.Get(ts.URL + "/api/jobs/" + other.ID + path)
+		if err != nil || resp.StatusCode != http.StatusNotFound {
+			t.Errorf("GET %s of another job = %v, %v, want 404", path, resp.StatusCode, err)
+		}
+	}
+	resp, err = http.Post(ts.URL+"/api/jobs/"+other.ID+"/cancel", "", nil)
+	if err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("cancel of another job = %v, %v, want 404", resp.StatusCode, err)
+	}
+	if job, _ := s.opts.Store.Get(other.ID); job.Status != jobs.StatusRunning {
+		t.Errorf("job of another process = %s, want running", job.Status)
+	}
+}
+
+func TestServerAllEvents(t *testing.T) {
+	_, ts := newTestServer(t)
+	input := filepath.Join(t.TempDir(), "a.mp4")
+	if err := os.WriteFile(input, []byte("original video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(ts.URL+"/api/jobs", "application/json", strings.NewReader(fmt.Sprintf(`{"input": %q, "config": {"cq": 28}}`, input)))
+	first := decodeJob(t, resp, err, http.StatusCreated)
+
+	resp, err = http.Get(ts.URL + "/api/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	resp2, err := http.Post(ts.URL+"/api/jobs", "application/json", strings.NewReader(fmt.Sprintf(`{"input": %q, "config": {"cq": 30}}`, input)))
+	second := decodeJob(t, resp2, err, http.StatusCreated)
+
+	// Both jobs are followed to the end over the one stream
+	done := map[string]bool{}
+	scanner := bufio.NewScanner(resp.Body)
+	for len(done) < 2 && scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var view jobView
+		if err := json.Unmarshal([]byte(data), &view); err != nil {
+			t.Fatal(err)
+		}
+		if view.Status == jobs.StatusSucceeded {
+			done[view.ID] = true
+		}
+	}
+	if !done[first.ID] || !done[second.ID] {
+		t.Errorf("succeeded jobs = %v, want %s and %s", done, first.ID, second.ID)
+	}
+}
+
+func TestServerRequestLimits(t *testing.T) {
+	s, ts := newTestServer(t)
+	s.opts.MaxUpload = 1 << 10
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", "large.mp4")
+	part.Write(make([]byte, 4<<10))
+	form.Close()
+	resp, err := http.Post(ts.URL+"/api/jobs", form.FormDataContentType(), &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("large upload: status = %d, want 413", resp.StatusCode)
+	}
+
+	large := `{"input": "a.mp4", "profile": "` + strings.Repeat("x", maxRequestBody) + `"}`
+	resp, err = http.Post(ts.URL+"/api/jobs", "application/json", strings.NewReader(large))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("large JSON body: status = %d, want 413", resp.StatusCode)
+	}
+}
+
+func TestServerRequeuesCrashedJobs(t *testing.T) {
+	dir := t.TempDir()
+	store, err := jobs.Open(filepath.Join(dir, "jobs.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A job of this server left running by a crash, and one run by another process
+	crashed, _ := store.Add(jobs.Job{Input: "/in/a.mp4", Output: filepath.Join(dir, OutputsDir, "1", "a"), Status: jobs.StatusRunning})
+	other, _ := store.Add(jobs.Job{Input: "/in/b.mp4", Output: filepath.Join(dir, "b"), Status: jobs.StatusRunning})
+
+	s, err := New(Options{Store: store, DataDir: dir, Resolve: func(string, config.Settings) (config.VideoConfig, error) {
+		return config.VideoConfig{}, nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ran := make(chan string, 2)
+	s.run = func(ctx context.Context, job jobs.Job) (*video.Result, error) {
+		ran <- job.ID
+		_, err := store.Update(job.ID, func(j *jobs.Job) error { j.Status = jobs.StatusSucceeded; return nil })
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := s.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cancel()
+		s.Wait()
+	}()
+
+	select {
+	case id := <-ran:
+		if id != crashed.ID {
+			t.Errorf("ran job %s, want %s", id, crashed.ID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the crashed job did not run again")
+	}
+	if job, _ := store.Get(other.ID); job.Status != jobs.StatusRunning {
+		t.Errorf("job of another process = %s, want running", job.Status)
+	}
+}
+
+func TestServerWebPage(t *testing.T) {
+	s, ts := newTestServer(t)
+	s.opts.Profiles = []string{"phone", "web"}
+
+	resp, err := http.Get(ts.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") || !bytes.Contains(page, []byte("/api/jobs")) {
+		t.Errorf("page = %s %q..., want the embedded page", resp.Header.Get("Content-Type"), page[:min(len(page), 40)])
+	}
+	if resp, err := http.Get(ts.URL + "/missing"); err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET /missing = %v, %v, want 404", resp.StatusCode, err)
+	}
+
+	resp, err = http.Get(ts.URL + "/api/profiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var profiles []string
+	json.NewDecoder(resp.Body).Decode(&profiles)
+	resp.Body.Close()
+	if strings.Join(profiles, ",") != "phone,web" {
+		t.Errorf("profiles = %q", profiles)
+	}
+}
@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"video_compressor/src/ffmpeg"
+	"video_compressor/src/filtergraph"
+)
+
+// CropRect describes a crop rectangle in source pixel coordinates
+type CropRect struct {
+	Width  int
+	Height int
+	X      int
+	Y      int
+}
+
+// cropSamplePoints are the relative positions in the video where cropdetect is run
+var cropSamplePoints = []float64{0.1, 0.25, 0.4, 0.55, 0.7, 0.85}
+
+// cropdetectPattern matches the crop suggestion printed by the cropdetect filter
+var cropdetectPattern = regexp.MustCompile(`crop=(\d+):(\d+):(\d+):(\d+)`)
+
+// DetectCrop samples frames at several points across the video with the cropdetect
+// filter and returns a crop rectangle that is stable across the samples
+func DetectCrop(ctx context.Context, ffmpegPath, videoPath string) (CropRect, error) {
+	duration, err := GetVideoDuration(ctx, videoPath)
+	if err != nil {
+		return CropRect{}, err
+	}
+
+	var samples []CropRect
+	for _, point := range cropSamplePoints {
+		cmd := ffmpeg.NewCommand(ffmpegPath, "-hide_banner").
+			AddInput(videoPath, "-ss", strconv.FormatFloat(duration*point, 'f', 3, 64))
+		out := cmd.AddOutput("-").Option("-frames:v", "30", "-an", "-sn")
+		out.VideoFilters = filtergraph.NewChain().Append(
+			filtergraph.New("cropdetect").With("limit", 24).With("round", 2).With("reset", 0),
+		)
+		out.Format = "null"
+
+		// cropdetect reports its results on stderr
+		output, err := ffmpeg.RunCombinedOutput(ctx, ffmpeg.DefaultRunner, cmd)
+		if ctx.Err() != nil {
+			return CropRect{}, ctx.Err()
+		}
+		if err != nil {
+			continue // Skip sample points that cannot be decoded
+		}
+
+		matches := cropdetectPattern.FindAllStringSubmatch(string(output), -1)
+		if len(matches) == 0 {
+			continue
+		}
+		// The last suggestion of a sample has seen the most frames
+		last := matches[len(matches)-1]
+		rect := CropRect{}
+		rect.Width, _ = strconv.Atoi(last[1])
+		rect.Height, _ = strconv.Atoi(last[2])
+		rect.X, _ = strconv.Atoi(last[3])
+		rect.Y, _ = strconv.Atoi(last[4])
+		if rect.Width <= 0 || rect.Height <= 0 {
+			continue
+		}
+		samples = append(samples, rect)
+	}
+
+	if len(samples) == 0 {
+		return CropRect{}, fmt.Errorf("cropdetect returned no results")
+	}
+
+	return stableCrop(samples), nil
+}
+
+// stableCrop picks the crop rectangle reported by the majority of samples.
+// If the samples disagree (e.g. dark scenes), the union of all rectangles is used
+// so that no picture content is cut off.
+func stableCrop(samples []CropRect) CropRect {
+	freq := make(map[CropRect]int)
+	var best CropRect
+	var bestCount int
+	for _, s := range samples {
+		freq[s]++
+		if freq[s] > bestCount {
+			best, bestCount = s, freq[s]
+		}
+	}
+	if bestCount*2 > len(samples) {
+		return best
+	}
+
+	left, top := samples[0].X, samples[0].Y
+	right, bottom := samples[0].X+samples[0].Width, samples[0].Y+samples[0].Height
+	for _, s := range samples[1:] {
+		left = min(left, s.X)
+		top = min(top, s.Y)
+		right = max(right, s.X+s.Width)
+		bottom = max(bottom, s.Y+s.Height)
+	}
+
+	// Keep the dimensions even (required by some codecs)
+	width := (right - left) - (right-left)%2
+	height := (bottom - top) - (bottom-top)%2
+	return CropRect{Width: width, Height: height, X: left, Y: top}
+}
@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"video_compressor/src/ffmpeg"
+)
+
+// fakeFFmpeg answers FFmpeg and ffprobe invocations with handler. ffprobe is looked up
+// in the working directory first, so the test runs in a directory with an empty one.
+func fakeFFmpeg(t *testing.T, handler func(inv ffmpeg.Invocation, stdout, stderr io.Writer) error) *ffmpeg.FakeRunner {
+	dir, wd := t.TempDir(), mustGetwd(t)
+	if err := os.WriteFile(filepath.Join(dir, "ffprobe"), nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	original := ffmpeg.DefaultRunner
+	fake := &ffmpeg.FakeRunner{Handler: handler}
+	ffmpeg.DefaultRunner = fake
+	t.Cleanup(func() {
+		ffmpeg.DefaultRunner = original
+		os.Chdir(wd)
+	})
+	return fake
+}
+
+func mustGetwd(t *testing.T) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wd
+}
+
+// argAfter returns the argument following name, "" if there is none
+func argAfter(args []string, name string) string {
+	if i := slices.Index(args, name); i >= 0 && i+1 < len(args) {
+		return args[i+1]
+	}
+	return ""
+}
+
+// cropdetectLog returns cropdetect output converging on the given crop
+func cropdetectLog(crops ...string) string {
+	log := "Input #0, matroska,webm, from 'in.mkv':\n  Duration: 00:02:00.00, start: 0.000000, bitrate: 5000 kb/s\n"
+	for i, crop := range crops {
+		log += fmt.Sprintf("[Parsed_cropdetect_0 @ 0x55d5c2a4e240] x1:0 x2:1919 y1:138 y2:941 w:1920 h:800 x:0 y:140 pts:%d t:%.6f limit:0.094118 %s\n",
+			1001*i, 0.041708*float64(i), crop)
+	}
+	return log + "frame=   30 fps=0.0 q=-0.0 Lsize=N/A time=00:00:01.20 bitrate=N/A speed=8.1x\n"
+}
+
+func TestDetectCrop(t *testing.T) {
+	fake := fakeFFmpeg(t, func(inv ffmpeg.Invocation, stdout, stderr io.Writer) error {
+		if filepath.Base(inv.Binary) == "ffprobe" {
+			_, err := io.WriteString(stdout, "120.000000\n")
+			return err
+		}
+		// Sample points at 10, 25, 40, 55, 70 and 85% of 120 seconds
+		switch argAfter(inv.Args, "-ss") {
+		case "84.000":
+			return fmt.Errorf("exit status 1")
+		case "102.000":
+			// A black scene reports no crop
+			_, err := io.WriteString(stderr, cropdetectLog())
+			return err
+		default:
+			// The first suggestions have seen few frames; the last one counts
+			_, err := io.WriteString(stderr, cropdetectLog("crop=1920:1072:0:4", "crop=1920:800:0:140"))
+			return err
+		}
+	})
+
+	rect, err := DetectCrop(context.Background(), "ffmpeg", "in.mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (CropRect{Width: 1920, Height: 800, X: 0, Y: 140}); rect != want {
+		t.Errorf("DetectCrop() = %+v, want %+v", rect, want)
+	}
+	if calls := fake.Calls(); len(calls) != 1+len(cropSamplePoints) {
+		t.Errorf("%d invocations, want ffprobe and %d samples", len(calls), len(cropSamplePoints))
+	}
+}
+
+func TestDetectCropNoResults(t *testing.T) {
+	fakeFFmpeg(t, func(inv ffmpeg.Invocation, stdout, stderr io.Writer) error {
+		if filepath.Base(inv.Binary) == "ffprobe" {
+			_, err := io.WriteString(stdout, "120.000000\n")
+			return err
+		}
+		_, err := io.WriteString(stderr, cropdetectLog())
+		return err
+	})
+	if rect, err := DetectCrop(context.Background(), "ffmpeg", "in.mkv"); err == nil {
+		t.Errorf("DetectCrop() = %+v, want an error", rect)
+	}
+}
+
+func TestStableCrop(t *testing.T) {
+	letterbox := CropRect{Width: 1920, Height: 800, X: 0, Y: 140}
+	tests := []struct {
+		name    string
+		samples []CropRect
+		want    CropRect
+	}{
+		{"single sample", []CropRect{letterbox}, letterbox},
+		{"majority", []CropRect{letterbox, letterbox, {Width: 1920, Height: 1080}, letterbox}, letterbox},
+		// Without a majority the union keeps all picture content
+		{"dark scenes", []CropRect{letterbox, {Width: 1200, Height: 600, X: 360, Y: 240}, {Width: 1920, Height: 900, X: 0, Y: 90}},
+			CropRect{Width: 1920, Height: 900, X: 0, Y: 90}},
+		{"tie", []CropRect{letterbox, {Width: 1440, Height: 1080, X: 240, Y: 0}},
+			CropRect{Width: 1920, Height: 1080, X: 0, Y: 0}},
+		{"odd union", []CropRect{{Width: 1000, Height: 500, X: 1, Y: 1}, {Width: 1000, Height: 500, X: 2, Y: 2}},
+			CropRect{Width: 1000, Height: 500, X: 1, Y: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stableCrop(tt.samples); got != tt.want {
+				t.Errorf("stableCrop() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+)
+
+// CopyFileTimes sets the access and modification times of dst to those of src
+func CopyFileTimes(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %v", src, err)
+	}
+	if err := os.Chtimes(dst, accessTime(info), info.ModTime()); err != nil {
+		return fmt.Errorf("failed to set file times: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+//go:build linux
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// accessTime returns the last access time of a file
+func accessTime(info os.FileInfo) time.Time {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return time.Unix(int64(st.Atim.Sec), int64(st.Atim.Nsec))
+	}
+	return info.ModTime()
+}
+
+// CopyXattrs copies the extended attributes in the user namespace (e.g. desktop tags
+// and download origins) from src to dst. Other namespaces need privileges to be written.
+func CopyXattrs(src, dst string) error {
+	size, err := syscall.Listxattr(src, nil)
+	if err != nil {
+		return fmt.Errorf("failed to list extended attributes: %v", err)
+	}
+	if size == 0 {
+		return nil
+	}
+	names := make([]byte, size)
+	size, err = syscall.Listxattr(src, names)
+	if err != nil {
+		return fmt.Errorf("failed to list extended attributes: %v", err)
+	}
+
+	// The list is a sequence of NUL-terminated names
+	for _, name := range strings.Split(strings.TrimRight(string(names[:size]), "\x00"), "\x00") {
+		if !strings.HasPrefix(name, "user.") {
+			continue
+		}
+		size, err := syscall.Getxattr(src, name, nil)
+		if err != nil {
+			return fmt.Errorf("failed to read extended attribute %s: %v", name, err)
+		}
+		value := make([]byte, size)
+		size, err = syscall.Getxattr(src, name, value)
+		if err != nil {
+			return fmt.Errorf("failed to read extended attribute %s: %v", name, err)
+		}
+		if err := syscall.Setxattr(dst, name, value[:size], 0); err != nil {
+			return fmt.Errorf("failed to write extended attribute %s: %v", name, err)
+		}
+	}
+	return nil
+}
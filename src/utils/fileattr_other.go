@@ -0,0 +1,19 @@
+//go:build !linux
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// accessTime returns the modification time, the access time is not portable
+func accessTime(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
+
+// CopyXattrs is only supported on Linux
+func CopyXattrs(src, dst string) error {
+	return fmt.Errorf("copying extended attributes is not supported on this platform")
+}
@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"video_compressor/src/ffmpeg"
+	"video_compressor/src/filtergraph"
+)
+
+// idetPattern matches the multi frame summary printed by the idet filter
+var idetPattern = regexp.MustCompile(`Multi frame detection:\s*TFF:\s*(\d+)\s*BFF:\s*(\d+)\s*Progressive:\s*(\d+)`)
+
+// DetectInterlace runs the idet filter on the beginning of the video and reports
+// whether the majority of the analyzed frames are interlaced
+func DetectInterlace(ctx context.Context, ffmpegPath, videoPath string) (bool, error) {
+	cmd := ffmpeg.NewCommand(ffmpegPath, "-hide_banner").AddInput(videoPath)
+	out := cmd.AddOutput("-").Option("-frames:v", "300", "-an", "-sn")
+	out.VideoFilters = filtergraph.NewChain().Append(filtergraph.New("idet"))
+	out.Format = "null"
+
+	// idet reports its results on stderr
+	output, err := ffmpeg.RunCombinedOutput(ctx, ffmpeg.DefaultRunner, cmd)
+	if err != nil {
+		return false, fmt.Errorf("idet failed: %v", err)
+	}
+
+	match := idetPattern.FindStringSubmatch(string(output))
+	if match == nil {
+		return false, fmt.Errorf("idet returned no results")
+	}
+	tff, _ := strconv.Atoi(match[1])
+	bff, _ := strconv.Atoi(match[2])
+	progressive, _ := strconv.Atoi(match[3])
+
+	return tff+bff > progressive, nil
+}
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"video_compressor/src/ffmpeg"
+)
+
+// idetLog returns idet output with the given single and multi frame detection lines
+func idetLog(single, multi string) string {
+	return "Input #0, mpegts, from 'in.ts':\n  Duration: 00:10:00.00, start: 1.400000, bitrate: 8000 kb/s\n" +
+		"frame=  300 fps=0.0 q=-0.0 Lsize=N/A time=00:00:10.01 bitrate=N/A speed=  21x\n" +
+		"[Parsed_idet_0 @ 0x5581d3a0c8c0] Repeated Fields: Neither:   301 Top:     0 Bottom:     0\n" +
+		"[Parsed_idet_0 @ 0x5581d3a0c8c0] Single frame detection: " + single + "\n" +
+		"[Parsed_idet_0 @ 0x5581d3a0c8c0] Multi frame detection: " + multi + "\n"
+}
+
+func TestDetectInterlace(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		fail    bool
+		want    bool
+		wantErr bool
+	}{
+		{"top field first", idetLog("TFF:   102 BFF:     0 Progressive:   150 Undetermined:    49",
+			"TFF:   280 BFF:     0 Progressive:    12 Undetermined:     9"), false, true, false},
+		{"bottom field first", idetLog("TFF:     0 BFF:   190 Progressive:    60 Undetermined:    51",
+			"TFF:     0 BFF:   251 Progressive:    40 Undetermined:    10"), false, true, false},
+		{"progressive", idetLog("TFF:     3 BFF:     1 Progressive:   270 Undetermined:    27",
+			"TFF:     0 BFF:     0 Progressive:   297 Undetermined:     4"), false, false, false},
+		// Only the multi frame detection counts
+		{"mixed", idetLog("TFF:   200 BFF:     0 Progressive:    80 Undetermined:    21",
+			"TFF:   100 BFF:    40 Progressive:   150 Undetermined:    11"), false, false, false},
+		{"no summary", "frame=    0 fps=0.0 q=0.0 Lsize=N/A time=N/A bitrate=N/A speed=N/A\n", false, false, true},
+		{"ffmpeg failure", "in.ts: Invalid data found when processing input\n", true, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeFFmpeg(t, func(inv ffmpeg.Invocation, stdout, stderr io.Writer) error {
+				io.WriteString(stderr, tt.output)
+				if tt.fail {
+					return fmt.Errorf("exit status 1")
+				}
+				return nil
+			})
+			got, err := DetectInterlace(context.Background(), "ffmpeg", "in.ts")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DetectInterlace() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("DetectInterlace() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
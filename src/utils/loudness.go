@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+
+	"video_compressor/src/ffmpeg"
+	"video_compressor/src/filtergraph"
+)
+
+// LoudnessStats holds the values measured by the first loudnorm pass
+type LoudnessStats struct {
+	Integrated float64 // Integrated loudness in LUFS
+	TruePeak   float64 // True peak in dBTP
+	Range      float64 // Loudness range in LU
+	Threshold  float64 // Gating threshold in LUFS
+	Offset     float64 // Gain offset for the second pass in LU
+}
+
+// loudnormPattern matches the JSON summary printed by loudnorm with print_format=json
+var loudnormPattern = regexp.MustCompile(`(?s)\{[^{}]*"input_i"[^{}]*\}`)
+
+// MeasureLoudness runs the loudnorm filter over one audio stream (a map specifier such
+// as "0:1") and returns the measured values for a second, linear normalization pass
+func MeasureLoudness(ctx context.Context, ffmpegPath, videoPath, stream string, loudnorm filtergraph.Filter) (LoudnessStats, error) {
+	cmd := ffmpeg.NewCommand(ffmpegPath, "-hide_banner", "-nostats").AddInput(videoPath)
+	out := cmd.AddOutput("-").Map(stream).Option("-vn", "-sn", "-dn")
+	out.AudioFilters = filtergraph.NewChain().Append(loudnorm.With("print_format", "json"))
+	out.Format = "null"
+
+	// loudnorm reports its results on stderr
+	output, err := ffmpeg.RunCombinedOutput(ctx, ffmpeg.DefaultRunner, cmd)
+	if err != nil {
+		return LoudnessStats{}, fmt.Errorf("loudnorm measurement failed: %v", err)
+	}
+
+	match := loudnormPattern.Find(output)
+	if match == nil {
+		return LoudnessStats{}, fmt.Errorf("loudnorm returned no results")
+	}
+	var measured struct {
+		InputI       string `json:"input_i"`
+		InputTP      string `json:"input_tp"`
+		InputLRA     string `json:"input_lra"`
+		InputThresh  string `json:"input_thresh"`
+		TargetOffset string `json:"target_offset"`
+	}
+	if err := json.Unmarshal(match, &measured); err != nil {
+		return LoudnessStats{}, fmt.Errorf("failed to parse loudnorm output: %v", err)
+	}
+
+	var stats LoudnessStats
+	for _, v := range []struct {
+		dst *float64
+		src string
+	}{
+		{&stats.Integrated, measured.InputI},
+		{&stats.TruePeak, measured.InputTP},
+		{&stats.Range, measured.InputLRA},
+		{&stats.Threshold, measured.InputThresh},
+		{&stats.Offset, measured.TargetOffset},
+	} {
+		f, err := strconv.ParseFloat(v.src, 64)
+		if err != nil {
+			return LoudnessStats{}, fmt.Errorf("failed to parse loudnorm value %q: %v", v.src, err)
+		}
+		*v.dst = f
+	}
+	// Silent streams measure -inf and cannot be normalized
+	if math.IsInf(stats.Integrated, 0) || math.IsInf(stats.Threshold, 0) {
+		return LoudnessStats{}, fmt.Errorf("audio stream is silent")
+	}
+	return stats, nil
+}
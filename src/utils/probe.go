@@ -0,0 +1,195 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"video_compressor/src/ffmpeg"
+)
+
+// StreamInfo holds the probed properties of a single stream
+type StreamInfo struct {
+	Index    int    `json:"index"`
+	Type     string `json:"type"` // "video", "audio", "subtitle", "attachment" or "data"
+	Codec    string `json:"codec"`
+	Language string `json:"language,omitempty"` // ISO 639-2 language tag, "" if untagged
+}
+
+// VideoInfo holds the probed properties of the first video stream of a file
+// together with a summary of all streams in the file
+type VideoInfo struct {
+	Width          int          `json:"width"`
+	Height         int          `json:"height"`
+	Codec          string       `json:"codec"`
+	PixelFormat    string       `json:"pixel_format"`
+	ColorTransfer  string       `json:"color_transfer"`
+	ColorPrimaries string       `json:"color_primaries"`
+	ColorSpace     string       `json:"color_space"`
+	Rotation       int          `json:"rotation"`                // Clockwise display rotation in degrees (0, 90, 180 or 270)
+	FrameRate      float64      `json:"frame_rate"`              // Average frame rate of the video stream
+	BitRate        int64        `json:"bit_rate"`                // Video stream bit rate in bits/s (overall bit rate if unknown)
+	Duration       float64      `json:"duration"`                // Container duration in seconds
+	CreationTime   string       `json:"creation_time,omitempty"` // Container creation_time tag, e.g. "2024-05-01T12:00:00.000000Z"
+	Streams        []StreamInfo `json:"streams"`
+}
+
+// ffprobeOutput mirrors the parts of ffprobe's JSON output that are used
+type ffprobeOutput struct {
+	Streams []struct {
+		Index          int    `json:"index"`
+		CodecType      string `json:"codec_type"`
+		CodecName      string `json:"codec_name"`
+		Width          int    `json:"width"`
+		Height         int    `json:"height"`
+		PixFmt         string `json:"pix_fmt"`
+		ColorTransfer  string `json:"color_transfer"`
+		ColorPrimaries string `json:"color_primaries"`
+		ColorSpace     string `json:"color_space"`
+		AvgFrameRate   string `json:"avg_frame_rate"`
+		BitRate        string `json:"bit_rate"`
+		Tags           struct {
+			Rotate   string `json:"rotate"`
+			Language string `json:"language"`
+		} `json:"tags"`
+		SideDataList []struct {
+			Rotation float64 `json:"rotation"`
+		} `json:"side_data_list"`
+	} `json:"streams"`
+	Format struct {
+		Duration string `json:"duration"`
+		BitRate  string `json:"bit_rate"`
+		Tags     struct {
+			CreationTime string `json:"creation_time"`
+		} `json:"tags"`
+	} `json:"format"`
+}
+
+// ProbeVideo returns the properties of the first video stream and all streams using ffprobe
+func ProbeVideo(ctx context.Context, videoPath string) (VideoInfo, error) {
+	ffprobePath, err := ffmpeg.CheckFFprobe()
+	if err != nil {
+		return VideoInfo{}, fmt.Errorf("ffprobe not found: %v", err)
+	}
+
+	cmd := ffmpeg.NewCommand(ffprobePath,
+		"-v", "error",
+		"-show_entries", "stream=index,codec_type,codec_name,width,height,pix_fmt,color_transfer,color_primaries,color_space,avg_frame_rate,bit_rate"+
+			":stream_tags=rotate,language:stream_side_data=rotation:format=duration,bit_rate:format_tags=creation_time",
+		"-of", "json",
+	).AddInput(videoPath)
+
+	output, err := ffmpeg.RunOutput(ctx, ffmpeg.DefaultRunner, cmd)
+	if err != nil {
+		return VideoInfo{}, fmt.Errorf("ffprobe error: %v", err)
+	}
+
+	var probe ffprobeOutput
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return VideoInfo{}, fmt.Errorf("failed to parse ffprobe output: %v", err)
+	}
+
+	var info VideoInfo
+	foundVideo := false
+	for _, s := range probe.Streams {
+		info.Streams = append(info.Streams, StreamInfo{
+			Index:    s.Index,
+			Type:     s.CodecType,
+			Codec:    s.CodecName,
+			Language: s.Tags.Language,
+		})
+		if s.CodecType != "video" || foundVideo {
+			continue
+		}
+		foundVideo = true
+		info.Width = s.Width
+		info.Height = s.Height
+		info.Codec = s.CodecName
+		info.PixelFormat = s.PixFmt
+		info.ColorTransfer = s.ColorTransfer
+		info.ColorPrimaries = s.ColorPrimaries
+		info.ColorSpace = s.ColorSpace
+		info.FrameRate = parseRational(s.AvgFrameRate)
+		info.BitRate, _ = strconv.ParseInt(s.BitRate, 10, 64)
+		// Newer FFmpeg versions report rotation as display matrix side data
+		// (counter-clockwise), older ones as a clockwise "rotate" tag
+		if len(s.SideDataList) > 0 {
+			for _, sd := range s.SideDataList {
+				if sd.Rotation != 0 {
+					info.Rotation = normalizeRotation(-int(math.Round(sd.Rotation)))
+				}
+			}
+		} else if r, err := strconv.Atoi(s.Tags.Rotate); err == nil {
+			info.Rotation = normalizeRotation(r)
+		}
+	}
+	if !foundVideo {
+		return VideoInfo{}, fmt.Errorf("no video stream found in %s", videoPath)
+	}
+	// Duration is optional (e.g. live streams)
+	info.Duration, _ = strconv.ParseFloat(probe.Format.Duration, 64)
+	info.CreationTime = probe.Format.Tags.CreationTime
+	// Some containers (e.g. MKV) only report the overall bit rate
+	if info.BitRate == 0 {
+		info.BitRate, _ = strconv.ParseInt(probe.Format.BitRate, 10, 64)
+	}
+
+	return info, nil
+}
+
+// parseRational parses an ffprobe rational such as "30000/1001" (0 if invalid)
+func parseRational(s string) float64 {
+	num, den, ok := strings.Cut(s, "/")
+	if !ok {
+		f, _ := strconv.ParseFloat(s, 64)
+		return f
+	}
+	n, err1 := strconv.ParseFloat(num, 64)
+	d, err2 := strconv.ParseFloat(den, 64)
+	if err1 != nil || err2 != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
+
+// normalizeRotation maps a rotation in degrees to 0, 90, 180 or 270
+func normalizeRotation(degrees int) int {
+	return ((degrees % 360) + 360) % 360
+}
+
+// DisplayDimensions returns the width and height after applying the display rotation.
+// FFmpeg rotates the frames of rotated sources before filtering (autorotate), so
+// filters and scaling work in these dimensions.
+func (v VideoInfo) DisplayDimensions() (width, height int) {
+	if v.Rotation == 90 || v.Rotation == 270 {
+		return v.Height, v.Width
+	}
+	return v.Width, v.Height
+}
+
+// BitsPerPixel returns the average number of video bits per pixel per frame (0 if unknown)
+func (v VideoInfo) BitsPerPixel() float64 {
+	if v.Width == 0 || v.Height == 0 || v.FrameRate == 0 || v.BitRate == 0 {
+		return 0
+	}
+	return float64(v.BitRate) / (float64(v.Width*v.Height) * v.FrameRate)
+}
+
+// IsHDR reports whether the video uses an HDR transfer function (HDR10/PQ or HLG)
+func (v VideoInfo) IsHDR() bool {
+	return v.ColorTransfer == "smpte2084" || v.ColorTransfer == "arib-std-b67"
+}
+
+// CountStreams returns the number of streams of the given type ("video", "audio", ...)
+func (v VideoInfo) CountStreams(streamType string) int {
+	n := 0
+	for _, s := range v.Streams {
+		if s.Type == streamType {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseRational(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+	}{
+		{"30000/1001", 30000.0 / 1001},
+		{"25/1", 25},
+		{"25", 25},
+		{"29.97", 29.97},
+		{"0/0", 0},
+		{"", 0},
+		{"n/a", 0},
+	}
+	for _, tt := range tests {
+		if got := parseRational(tt.in); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("parseRational(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
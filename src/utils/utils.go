@@ -1,11 +1,11 @@
 package utils
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"math/rand"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -15,21 +15,15 @@ import (
 )
 
 // checks if the video file is valid
-func IsVideoFileValid(inputPath string) bool {
+func IsVideoFileValid(ctx context.Context, inputPath string) bool {
 	ffmpegPath, err := ffmpeg.CheckFFmpeg()
 	if err != nil {
 		return false
 	}
 
-	args := []string{
-		"-v", "error",
-		"-i", inputPath,
-		"-f", "null",
-		"-",
-	}
-
-	cmd := exec.Command(ffmpegPath, args...)
-	output, err := cmd.CombinedOutput()
+	cmd := ffmpeg.NewCommand(ffmpegPath, "-v", "error").AddInput(inputPath)
+	cmd.AddOutput("-").Format = "null"
+	output, err := ffmpeg.RunCombinedOutput(ctx, ffmpeg.DefaultRunner, cmd)
 
 	// if there is no error and no error output, the video is valid
 	return err == nil && len(strings.TrimSpace(string(output))) == 0
@@ -44,47 +38,46 @@ func GetVideoSize(videoPath string) (int64, error) {
 	return fileInfo.Size(), nil
 }
 
-// GetVideoDimensions returns the width and height of the video using ffprobe
-func GetVideoDimensions(videoPath string) (width, height int, err error) {
-	ffprobePath, err := ffmpeg.CheckFFprobe()
+// GetVideoDimensions returns the displayed width and height of the video using ffprobe.
+// The dimensions of rotated videos (e.g. portrait phone recordings) are swapped.
+func GetVideoDimensions(ctx context.Context, videoPath string) (width, height int, err error) {
+	info, err := ProbeVideo(ctx, videoPath)
 	if err != nil {
-		return 0, 0, fmt.Errorf("ffprobe not found: %v", err)
+		return 0, 0, err
 	}
+	width, height = info.DisplayDimensions()
+	return width, height, nil
+}
 
-	cmd := exec.Command(ffprobePath,
-		"-v", "error",
-		"-select_streams", "v:0",
-		"-show_entries", "stream=width,height",
-		"-of", "csv=p=0",
-		videoPath,
-	)
-
-	output, err := cmd.Output()
+// GetVideoDuration returns the duration of the video in seconds using ffprobe
+func GetVideoDuration(ctx context.Context, videoPath string) (float64, error) {
+	ffprobePath, err := ffmpeg.CheckFFprobe()
 	if err != nil {
-		return 0, 0, fmt.Errorf("ffprobe error: %v", err)
+		return 0, fmt.Errorf("ffprobe not found: %v", err)
 	}
 
-	dimensions := strings.Split(strings.TrimSpace(string(output)), ",")
-	if len(dimensions) != 2 {
-		return 0, 0, fmt.Errorf("unexpected ffprobe output format")
-	}
+	cmd := ffmpeg.NewCommand(ffprobePath,
+		"-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "csv=p=0",
+	).AddInput(videoPath)
 
-	width, err = strconv.Atoi(dimensions[0])
+	output, err := ffmpeg.RunOutput(ctx, ffmpeg.DefaultRunner, cmd)
 	if err != nil {
-		return 0, 0, fmt.Errorf("failed to parse width: %v", err)
+		return 0, fmt.Errorf("ffprobe error: %v", err)
 	}
 
-	height, err = strconv.Atoi(dimensions[1])
+	duration, err := strconv.ParseFloat(strings.TrimSpace(string(output)), 64)
 	if err != nil {
-		return 0, 0, fmt.Errorf("failed to parse height: %v", err)
+		return 0, fmt.Errorf("failed to parse duration: %v", err)
 	}
 
-	return width, height, nil
+	return duration, nil
 }
 
 // AnalyzeVideoRatios analyzes video aspect ratios in a directory and returns ratio based on specified mode
 // mode: most_common, min, max, average
-func AnalyzeVideoRatios(inputDir string, mode string) (ratio float64, err error) {
+func AnalyzeVideoRatios(ctx context.Context, inputDir string, mode string) (ratio float64, err error) {
 	// Get all video files in the directory
 	files, err := os.ReadDir(inputDir)
 	if err != nil {
@@ -125,7 +118,7 @@ func AnalyzeVideoRatios(inputDir string, mode string) (ratio float64, err error)
 	// Analyze sampled video files
 	for _, fileName := range sample {
 		videoPath := filepath.Join(inputDir, fileName)
-		w, h, err := GetVideoDimensions(videoPath)
+		w, h, err := GetVideoDimensions(ctx, videoPath)
 		if err != nil {
 			continue // Skip files that can't be analyzed
 		}
@@ -250,8 +243,14 @@ func GetRecommendedSettings(resolution config.Resolution, originalWidth, origina
 	aspectRatio := float64(originalWidth) / float64(originalHeight)
 
 	if originalHeight > originalWidth {
-		// Portrait video
-		width = int(float64(height) * aspectRatio)
+		// Portrait video: the resolution bounds the short edge (width)
+		width = height
+		height = int(float64(width) / aspectRatio)
+		// If height exceeds common maximums, scale down
+		if height > 3840 {
+			height = 3840
+			width = int(float64(height) * aspectRatio)
+		}
 	} else {
 		// Landscape video
 		width = int(float64(height) * aspectRatio)
@@ -292,8 +291,14 @@ func GetResolutionDimensionsRatio(resolution config.Resolution, ratio float64) (
 
 	// Calculate width based on aspect ratio
 	if ratio < 1 {
-		// Portrait video
-		width = int(float64(height) * ratio)
+		// Portrait video: the resolution bounds the short edge (width)
+		width = height
+		height = int(float64(width) / ratio)
+		// If height exceeds common maximums, scale down
+		if height > 3840 {
+			height = 3840
+			width = int(float64(height) * ratio)
+		}
 	} else {
 		// Landscape video
 		width = int(float64(height) * ratio)
@@ -310,3 +315,74 @@ func GetResolutionDimensionsRatio(resolution config.Resolution, ratio float64) (
 
 	return width, height
 }
+
+// ConstrainDimensions applies the scale policy and the max-width/max-height bounds of cfg to
+// the target dimensions. sourceWidth and sourceHeight are the largest dimensions of the input
+// (0 if unknown). The aspect ratio of the target is preserved.
+func ConstrainDimensions(cfg config.VideoConfig, width, height, sourceWidth, sourceHeight int) (int, int) {
+	if width <= 0 || height <= 0 {
+		return width, height
+	}
+	w, h := float64(width), float64(height)
+
+	// Fit inside the box of the resolution (e.g. 1920x1080 for 1080p, rotated for portrait)
+	if cfg.ScalePolicy == config.ScaleFitBox {
+		short := math.Min(w, h)
+		boxW, boxH := short*16/9, short
+		if h > w {
+			boxW, boxH = boxH, boxW
+		}
+		scale := math.Min(boxW/w, boxH/h)
+		w, h = w*scale, h*scale
+	}
+
+	// Never upscale beyond the source dimensions
+	if cfg.ScalePolicy != config.ScaleAllowUpscale && sourceWidth > 0 && sourceHeight > 0 {
+		scale := math.Min(float64(sourceWidth)/w, float64(sourceHeight)/h)
+		if scale < 1 {
+			w, h = w*scale, h*scale
+		}
+	}
+
+	// Apply max-width/max-height bounds
+	scale := 1.0
+	if cfg.MaxWidth > 0 && w > float64(cfg.MaxWidth) {
+		scale = math.Min(scale, float64(cfg.MaxWidth)/w)
+	}
+	if cfg.MaxHeight > 0 && h > float64(cfg.MaxHeight) {
+		scale = math.Min(scale, float64(cfg.MaxHeight)/h)
+	}
+	w, h = w*scale, h*scale
+
+	// Ensure dimensions are even numbers (required by some codecs)
+	width, height = int(w), int(h)
+	width = width - (width % 2)
+	height = height - (height % 2)
+
+	return width, height
+}
+
+// GetMaxDimensions returns the largest width and height of all video files in a directory
+func GetMaxDimensions(ctx context.Context, inputDir string) (width, height int, err error) {
+	files, err := os.ReadDir(inputDir)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read directory: %v", err)
+	}
+
+	for _, file := range files {
+		if file.IsDir() || !ffmpeg.IsSupportedFormat(file.Name()) {
+			continue
+		}
+		w, h, err := GetVideoDimensions(ctx, filepath.Join(inputDir, file.Name()))
+		if err != nil {
+			continue // Skip files that can't be analyzed
+		}
+		width = max(width, w)
+		height = max(height, h)
+	}
+
+	if width == 0 || height == 0 {
+		return 0, 0, fmt.Errorf("no valid videos could be analyzed")
+	}
+	return width, height, nil
+}
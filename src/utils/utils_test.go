@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"testing"
+
+	"video_compressor/src/config"
+)
+
+func TestConstrainDimensions(t *testing.T) {
+	tests := []struct {
+		name             string
+		policy           config.ScalePolicy
+		maxWidth         int
+		maxHeight        int
+		width, height    int
+		sourceW, sourceH int
+		wantW, wantH     int
+	}{
+		{"never upscale", config.ScaleNeverUpscale, 0, 0, 1920, 1080, 1280, 720, 1280, 720},
+		{"never upscale portrait", config.ScaleNeverUpscale, 0, 0, 1080, 1920, 720, 1280, 720, 1280},
+		{"larger source", config.ScaleNeverUpscale, 0, 0, 1920, 1080, 3840, 2160, 1920, 1080},
+		{"unknown source", config.ScaleNeverUpscale, 0, 0, 1920, 1080, 0, 0, 1920, 1080},
+		{"allow upscale", config.ScaleAllowUpscale, 0, 0, 1920, 1080, 1280, 720, 1920, 1080},
+		{"fit wide target", config.ScaleFitBox, 0, 0, 2560, 1080, 2560, 1080, 1920, 810},
+		{"fit tall target", config.ScaleFitBox, 0, 0, 1080, 2560, 1080, 2560, 810, 1920},
+		{"fit 16:9 target", config.ScaleFitBox, 0, 0, 1920, 1080, 3840, 2160, 1920, 1080},
+		{"max width", config.ScaleAllowUpscale, 1280, 0, 1920, 1080, 0, 0, 1280, 720},
+		{"max height", config.ScaleAllowUpscale, 0, 480, 1920, 1080, 0, 0, 852, 480},
+		{"both bounds", config.ScaleAllowUpscale, 1000, 720, 1920, 1080, 0, 0, 1000, 562},
+		{"bounds after policy", config.ScaleNeverUpscale, 0, 600, 1920, 1080, 1280, 720, 1066, 600},
+		{"odd custom size", config.ScaleAllowUpscale, 0, 0, 1001, 601, 0, 0, 1000, 600},
+		{"no target", config.ScaleNeverUpscale, 0, 0, 0, 0, 1280, 720, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.VideoConfig{ScalePolicy: tt.policy, MaxWidth: tt.maxWidth, MaxHeight: tt.maxHeight}
+			w, h := ConstrainDimensions(cfg, tt.width, tt.height, tt.sourceW, tt.sourceH)
+			if w != tt.wantW || h != tt.wantH {
+				t.Errorf("ConstrainDimensions() = %dx%d, want %dx%d", w, h, tt.wantW, tt.wantH)
+			}
+		})
+	}
+}
+
+func TestGetRecommendedSettings(t *testing.T) {
+	tests := []struct {
+		name             string
+		resolution       config.Resolution
+		sourceW, sourceH int
+		wantW, wantH     int
+		wantBitrate      int
+	}{
+		{"unknown source", config.Resolution1080p, 0, 0, 1920, 1080, 5000},
+		{"landscape", config.Resolution720p, 1920, 1080, 1280, 720, 2500},
+		{"wide landscape", config.Resolution1080p, 1920, 800, 2592, 1080, 5000},
+		{"portrait", config.Resolution1080p, 1080, 1920, 1080, 1920, 5000},
+		{"portrait 720p", config.Resolution720p, 1080, 1920, 720, 1280, 2500},
+		{"tall portrait capped", config.Resolution4K, 1080, 2520, 1644, 3840, 20000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, h, br := GetRecommendedSettings(tt.resolution, tt.sourceW, tt.sourceH)
+			if w != tt.wantW || h != tt.wantH || br != tt.wantBitrate {
+				t.Errorf("GetRecommendedSettings() = %dx%d %dk, want %dx%d %dk", w, h, br, tt.wantW, tt.wantH, tt.wantBitrate)
+			}
+		})
+	}
+}
+
+func TestGetResolutionDimensionsRatio(t *testing.T) {
+	tests := []struct {
+		name         string
+		resolution   config.Resolution
+		ratio        float64
+		wantW, wantH int
+	}{
+		{"landscape", config.Resolution1080p, 16.0 / 9, 1920, 1080},
+		{"wide landscape capped", config.Resolution4K, 2.4, 3840, 1600},
+		{"portrait", config.Resolution720p, 9.0 / 16, 720, 1280},
+		{"portrait 360p", config.Resolution360p, 9.0 / 16, 360, 640},
+		{"tall portrait capped", config.Resolution4K, 0.5, 1920, 3840},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, h := GetResolutionDimensionsRatio(tt.resolution, tt.ratio)
+			if w != tt.wantW || h != tt.wantH {
+				t.Errorf("GetResolutionDimensionsRatio() = %dx%d, want %dx%d", w, h, tt.wantW, tt.wantH)
+			}
+		})
+	}
+}
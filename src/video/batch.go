@@ -0,0 +1,75 @@
+package video
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"video_compressor/src/config"
+	"video_compressor/src/ffmpeg"
+	"video_compressor/src/jobs"
+
+	"github.com/fvbommel/sortorder"
+)
+
+// CompressDirectory compresses every supported video in inputDir into outputDir.
+// Processing continues after a failed input; every input gets a Result and the error
+// counts the failed inputs. With a job store, every input is recorded as a job and
+// inputs already processed with the same settings are skipped unless reprocess is set.
+func CompressDirectory(ctx context.Context, inputDir, outputDir string, cfg config.VideoConfig, verbose bool, store *jobs.Store, reprocess bool) ([]*Result, error) {
+	files, err := listVideos(inputDir)
+	if err != nil {
+		return nil, err
+	}
+	if !cfg.DryRun {
+		if err := os.MkdirAll(outputDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create output directory: %v", err)
+		}
+	}
+
+	var results []*Result
+	failed := 0
+	for i, name := range files {
+		if ctx.Err() != nil {
+			return results, ctx.Err()
+		}
+		in := filepath.Join(inputDir, name)
+		out := filepath.Join(outputDir, strings.TrimSuffix(name, filepath.Ext(name)))
+		fmt.Printf("[%d/%d] %s\n", i+1, len(files), name)
+
+		result, err := CompressTracked(ctx, store, in, out, cfg, verbose, !reprocess)
+		if err != nil {
+			fmt.Printf("❌ Error processing %s: %v\n", name, err)
+			failed++
+		}
+		results = append(results, result)
+	}
+	if failed > 0 {
+		return results, fmt.Errorf("%d of %d inputs failed", failed, len(files))
+	}
+	return results, nil
+}
+
+// listVideos returns the names of the supported videos in dir in natural order
+func listVideos(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %v", err)
+	}
+	var files []string
+	for _, e := range entries {
+		if !e.IsDir() && ffmpeg.IsSupportedFormat(e.Name()) {
+			files = append(files, e.Name())
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no video files (%v supported containers) found in %s", ffmpeg.SupportedFormatsKeys(), dir)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return sortorder.NaturalLess(files[i], files[j])
+	})
+	return files, nil
+}
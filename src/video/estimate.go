@@ -0,0 +1,184 @@
+package video
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"video_compressor/src/config"
+	"video_compressor/src/ffmpeg"
+	"video_compressor/src/utils"
+)
+
+// Estimate is the predicted outcome of compressing an input, extrapolated from sample encodes
+type Estimate struct {
+	Input      string
+	Duration   float64 // Source duration in seconds
+	InputSize  int64
+	Size       int64   // Estimated output size in bytes
+	EncodeTime float64 // Estimated encode time in seconds
+	Samples    int     // Number of sample encodes
+	Reason     string  // Why the input would be skipped, "" if it would be encoded
+}
+
+// Reduction returns the estimated size reduction in percent
+func (e *Estimate) Reduction() float64 {
+	if e.InputSize == 0 {
+		return 0
+	}
+	return (1 - float64(e.Size)/float64(e.InputSize)) * 100
+}
+
+// EstimateVideo encodes samples of sampleSeconds each, spread evenly across the input,
+// with the effective configuration and extrapolates the output size and encode time.
+// Loudness is normalized in a single pass for the samples, so the measurement pass of
+// -loudnorm is not included in the time. The fixed cost of an FFmpeg invocation
+// (startup, probing, encoder setup) is measured with a single-frame encode and counted
+// once instead of being scaled with the samples.
+func EstimateVideo(ctx context.Context, inputPath string, cfg config.VideoConfig, samples int, sampleSeconds float64) (*Estimate, error) {
+	if samples < 1 || sampleSeconds <= 0 {
+		return nil, fmt.Errorf("at least one sample of positive length is required")
+	}
+	tempDir, err := os.MkdirTemp("", "video_estimate_*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Plan like a dry run: no loudness measurement and nothing written for skipped inputs
+	cfg.DryRun = true
+	cfg.Overwrite = config.OverwriteAlways
+	result := &Result{Input: inputPath}
+	job, err := planCompress(ctx, inputPath, filepath.Join(tempDir, "sample"), cfg, false, result)
+	if err != nil {
+		return nil, err
+	}
+	estimate := &Estimate{Input: inputPath, InputSize: result.InputSize}
+	if job == nil {
+		// Skipped inputs are kept or copied as they are
+		estimate.Size, estimate.Reason = result.InputSize, result.Reason
+		return estimate, nil
+	}
+	if !job.probed || job.source.Duration <= 0 {
+		return nil, fmt.Errorf("cannot estimate %s: duration unknown", inputPath)
+	}
+	estimate.Duration = job.source.Duration
+
+	var sampleDuration, sampleTime float64
+	var sampleSize int64
+	starts, sampleLength := sampleWindows(job.source.Duration, samples, sampleSeconds)
+	for i, start := range starts {
+		out := filepath.Join(tempDir, fmt.Sprintf("sample_%d%s", i, job.ext))
+		length := sampleLength
+		cmd := buildSampleCommand(job, out, start, length)
+		begin := time.Now()
+		if err := runFFmpeg(ctx, cmd, job.cfg, false); err != nil {
+			return nil, fmt.Errorf("sample encode failed: %v", err)
+		}
+		sampleTime += time.Since(begin).Seconds()
+
+		size, err := utils.GetVideoSize(out)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get sample size: %v", err)
+		}
+		sampleSize += size
+		// The encoded length can differ from the requested one at keyframes and the end
+		if info, err := utils.ProbeVideo(ctx, out); err == nil && info.Duration > 0 {
+			length = info.Duration
+		}
+		sampleDuration += length
+		estimate.Samples++
+	}
+	if sampleDuration <= 0 {
+		return nil, fmt.Errorf("cannot estimate %s: samples are empty", inputPath)
+	}
+
+	baseline, err := measureBaseline(ctx, job, filepath.Join(tempDir, "baseline"+job.ext))
+	if err != nil {
+		return nil, err
+	}
+
+	scale := job.source.Duration / sampleDuration
+	estimate.Size = int64(float64(sampleSize) * scale)
+	estimate.EncodeTime = extrapolateTime(sampleTime, baseline, estimate.Samples, scale)
+	return estimate, nil
+}
+
+// measureBaseline returns the wall time of encoding a single frame of the job's input,
+// i.e. the fixed cost every FFmpeg invocation pays regardless of the encoded length
+func measureBaseline(ctx context.Context, job *compressJob, outputPath string) (float64, error) {
+	frame := 1 / 25.0
+	if job.source.FrameRate > 0 {
+		frame = 1 / job.source.FrameRate
+	}
+	cmd := buildSampleCommand(job, outputPath, 0, frame)
+	begin := time.Now()
+	if err := runFFmpeg(ctx, cmd, job.cfg, false); err != nil {
+		return 0, fmt.Errorf("baseline encode failed: %v", err)
+	}
+	return time.Since(begin).Seconds(), nil
+}
+
+// extrapolateTime scales the time the samples spent encoding to the full input. The
+// baseline of each sample invocation is removed before scaling and added back once for
+// the single invocation encoding the whole input.
+func extrapolateTime(sampleTime, baseline float64, samples int, scale float64) float64 {
+	encode := sampleTime - baseline*float64(samples)
+	if encode < 0 {
+		encode = 0
+	}
+	return baseline + encode*scale
+}
+
+// EstimateDirectory estimates every supported video in inputDir. Inputs that cannot be
+// estimated are reported and left out; the error counts them.
+func EstimateDirectory(ctx context.Context, inputDir string, cfg config.VideoConfig, samples int, sampleSeconds float64) ([]*Estimate, error) {
+	files, err := listVideos(inputDir)
+	if err != nil {
+		return nil, err
+	}
+	var estimates []*Estimate
+	failed := 0
+	for i, name := range files {
+		if ctx.Err() != nil {
+			return estimates, ctx.Err()
+		}
+		fmt.Printf("[%d/%d] %s\n", i+1, len(files), name)
+		estimate, err := EstimateVideo(ctx, filepath.Join(inputDir, name), cfg, samples, sampleSeconds)
+		if err != nil {
+			fmt.Printf("❌ Error estimating %s: %v\n", name, err)
+			failed++
+			continue
+		}
+		estimates = append(estimates, estimate)
+	}
+	if failed > 0 {
+		return estimates, fmt.Errorf("%d of %d inputs could not be estimated", failed, len(files))
+	}
+	return estimates, nil
+}
+
+// sampleWindows returns the start times of n samples of the given length spread evenly
+// across duration. Short inputs are encoded in full as a single sample.
+func sampleWindows(duration float64, n int, length float64) (starts []float64, sampleLength float64) {
+	if duration <= float64(n)*length {
+		return []float64{0}, duration
+	}
+	starts = make([]float64, n)
+	for i := range starts {
+		// Center each sample in one of n equal parts of the input
+		starts[i] = duration*(float64(i)+0.5)/float64(n) - length/2
+	}
+	return starts, length
+}
+
+// buildSampleCommand builds the command encoding length seconds from start of the job's input
+func buildSampleCommand(job *compressJob, outputPath string, start, length float64) *ffmpeg.Command {
+	cmd := buildCompressCommand(job.inputPath, outputPath, job.ext, job.cfg, job.plan)
+	// Seek the main input before decoding; the length applies to the whole output
+	cmd.Inputs[0].Options = append(cmd.Inputs[0].Options, "-ss", formatSeconds(start))
+	cmd.Outputs[0].Option("-t", formatSeconds(length))
+	return cmd
+}
@@ -0,0 +1,48 @@
+package video
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSampleWindows(t *testing.T) {
+	starts, length := sampleWindows(600, 3, 10)
+	if want := []float64{95, 295, 495}; !reflect.DeepEqual(starts, want) || length != 10 {
+		t.Errorf("sampleWindows(600) = %v, %v, want %v, 10", starts, length, want)
+	}
+	// Inputs shorter than all samples together are encoded in full
+	starts, length = sampleWindows(25, 3, 10)
+	if want := []float64{0}; !reflect.DeepEqual(starts, want) || length != 25 {
+		t.Errorf("sampleWindows(25) = %v, %v, want %v, 25", starts, length, want)
+	}
+}
+
+func TestBuildSampleCommand(t *testing.T) {
+	job := &compressJob{inputPath: "in.mov", ext: ".mp4", cfg: testConfig("cpu")}
+	want := []string{"-y", "-ss", "95.000", "-i", "in.mov"}
+	want = append(want, x264Args...)
+	want = append(want, "-vf", "scale=1920:1080", "-t", "10.000", "-f", "mp4", "sample.mp4")
+	if got := buildSampleCommand(job, "sample.mp4", 95, 10).Args(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Args() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestExtrapolateTime(t *testing.T) {
+	tests := []struct {
+		sampleTime, baseline float64
+		samples              int
+		scale                float64
+		want                 float64
+	}{
+		// 3 samples of 4s each, 1s of which is startup: 3 x 3s of encoding scaled by 20
+		{12, 1, 3, 20, 181},
+		{12, 0, 3, 20, 240},
+		// A baseline slower than the samples leaves only the startup
+		{2, 1, 3, 20, 1},
+	}
+	for _, tt := range tests {
+		if got := extrapolateTime(tt.sampleTime, tt.baseline, tt.samples, tt.scale); got != tt.want {
+			t.Errorf("extrapolateTime(%v, %v, %d, %v) = %v, want %v", tt.sampleTime, tt.baseline, tt.samples, tt.scale, got, tt.want)
+		}
+	}
+}
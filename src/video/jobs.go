@@ -0,0 +1,101 @@
+package video
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"video_compressor/src/config"
+	"video_compressor/src/jobs"
+)
+
+// jobCancelInterval is how often a running job checks whether it was cancelled in the store
+const jobCancelInterval = 2 * time.Second
+
+// CompressTracked compresses a video like CompressVideo and records it as a job in store.
+// If skipProcessed is set, an input that a job already compressed with the same settings
+// is skipped. Without a store it is CompressVideo; dry runs only check for processed inputs.
+func CompressTracked(ctx context.Context, store *jobs.Store, inputPath, outputPath string, cfg config.VideoConfig, verbose, skipProcessed bool) (*Result, error) {
+	if store == nil {
+		return CompressVideo(ctx, inputPath, outputPath, cfg, verbose)
+	}
+	if abs, err := filepath.Abs(inputPath); err == nil {
+		inputPath = abs
+	}
+	if abs, err := filepath.Abs(outputPath); err == nil {
+		outputPath = abs
+	}
+	if skipProcessed {
+		if result, err := processedResult(store, inputPath, cfg); err != nil || result != nil {
+			return result, err
+		}
+	}
+	if cfg.DryRun {
+		return CompressVideo(ctx, inputPath, outputPath, cfg, verbose)
+	}
+	return RunJob(ctx, store, jobs.Job{Input: inputPath, Output: outputPath, Config: cfg}, verbose)
+}
+
+// RunJob compresses the input of a job with its settings and records the attempt and its
+// outcome in store. A job without ID is added, or resumes an unfinished one for the same
+// input, settings and output. Cancelling the job in the store stops the compression.
+func RunJob(ctx context.Context, store *jobs.Store, job jobs.Job, verbose bool) (*Result, error) {
+	hash, err := jobs.HashFile(job.Input)
+	if err != nil {
+		return &Result{Input: job.Input, Decision: DecisionFailed, Reason: err.Error()}, err
+	}
+	job.InputHash, job.ConfigHash = hash, jobs.ConfigHash(job.Config)
+	job, err = store.Start(job)
+	if err != nil {
+		return &Result{Input: job.Input, Decision: DecisionFailed, Reason: err.Error()}, err
+	}
+
+	jobCtx, cancel := store.WatchCancel(ctx, job.ID, jobCancelInterval)
+	defer cancel()
+	result, err := CompressVideo(jobCtx, job.Input, job.Output, job.Config, verbose)
+	if jobCtx.Err() != nil && ctx.Err() == nil {
+		err = fmt.Errorf("job %s was cancelled", job.ID)
+		result.Decision, result.Reason = DecisionFailed, err.Error()
+	}
+
+	_, storeErr := store.Update(job.ID, func(j *jobs.Job) error {
+		j.Finished = time.Now()
+		switch {
+		case err == nil:
+			j.Status, j.Error = jobs.StatusSucceeded, ""
+		case jobCtx.Err() != nil:
+			// Cancelled in the store or interrupted by a signal
+			j.Status, j.Error = jobs.StatusCancelled, err.Error()
+		default:
+			j.Status, j.Error = jobs.StatusFailed, err.Error()
+		}
+		j.Written, j.Decision = result.Output, string(result.Decision)
+		j.InputSize, j.OutputSize = result.InputSize, result.OutputSize
+		j.Encoder, j.WallTime, j.Speed = result.Encoder, result.WallTime, result.Speed
+		return nil
+	})
+	if storeErr != nil {
+		fmt.Printf("Warning: failed to record job %s: %v\n", job.ID, storeErr)
+	}
+	return result, err
+}
+
+// processedResult returns a skipped result if a job already compressed the input with
+// the same settings, nil otherwise
+func processedResult(store *jobs.Store, inputPath string, cfg config.VideoConfig) (*Result, error) {
+	hash, err := jobs.HashFile(inputPath)
+	if err != nil {
+		return &Result{Input: inputPath, Decision: DecisionFailed, Reason: err.Error()}, err
+	}
+	job, found, err := store.Processed(hash, jobs.ConfigHash(cfg))
+	if err != nil {
+		return &Result{Input: inputPath, Decision: DecisionFailed, Reason: err.Error()}, err
+	}
+	if !found {
+		return nil, nil
+	}
+	reason := fmt.Sprintf("already processed with the same settings by job %s", job.ID)
+	fmt.Printf("Skipping %s: %s\n", filepath.Base(inputPath), reason)
+	return &Result{Input: inputPath, Decision: DecisionSkipped, Reason: reason, InputSize: job.InputSize}, nil
+}
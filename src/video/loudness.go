@@ -0,0 +1,59 @@
+package video
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"video_compressor/src/config"
+	"video_compressor/src/ffmpeg"
+	"video_compressor/src/filtergraph"
+	"video_compressor/src/utils"
+)
+
+// loudnessSampleRate is the output sample rate of normalized audio; loudnorm
+// resamples to 192 kHz internally
+const loudnessSampleRate = 48000
+
+// loudnessFilters measures every selected audio stream and returns the filter chain
+// of the second, linear loudnorm pass for each of them in output order
+func loudnessFilters(ctx context.Context, inputPath string, streams []utils.StreamInfo, cfg config.VideoConfig, verbose bool) ([]*filtergraph.Chain, error) {
+	var chains []*filtergraph.Chain
+	for _, s := range streams {
+		if s.Type != "audio" {
+			continue
+		}
+		loudnorm := ffmpeg.LoudnormFilter(cfg)
+		// A dry run does not decode the audio; the measured values are filled in when encoding
+		if cfg.DryRun {
+			chains = append(chains, filtergraph.NewChain().Append(loudnorm, filtergraph.New("aresample", loudnessSampleRate)))
+			continue
+		}
+		stats, err := utils.MeasureLoudness(ctx, cfg.FfmpegPath, inputPath, "0:"+strconv.Itoa(s.Index), loudnorm)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			// loudnorm without measurements normalizes dynamically in a single pass
+			fmt.Printf("Warning: cannot measure loudness of audio stream %d, using single-pass normalization: %v\n", s.Index, err)
+		} else {
+			if verbose {
+				fmt.Printf("Audio stream %d: %.2f LUFS, %.2f dBTP, %.2f LU\n", s.Index, stats.Integrated, stats.TruePeak, stats.Range)
+			}
+			loudnorm = loudnorm.
+				With("measured_I", formatLoudness(stats.Integrated)).
+				With("measured_TP", formatLoudness(stats.TruePeak)).
+				With("measured_LRA", formatLoudness(stats.Range)).
+				With("measured_thresh", formatLoudness(stats.Threshold)).
+				With("offset", formatLoudness(stats.Offset)).
+				With("linear", "true")
+		}
+		chains = append(chains, filtergraph.NewChain().Append(loudnorm, filtergraph.New("aresample", loudnessSampleRate)))
+	}
+	return chains, nil
+}
+
+// formatLoudness formats a measured loudness value with two decimals
+func formatLoudness(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
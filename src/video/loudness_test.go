@@ -0,0 +1,87 @@
+package video
+
+import (
+	"context"
+	"io"
+	"slices"
+	"testing"
+
+	"video_compressor/src/ffmpeg"
+	"video_compressor/src/utils"
+)
+
+// loudnormOutput is the end of the stderr output of a loudnorm measurement pass
+const loudnormOutput = `[Parsed_loudnorm_0 @ 0x5581] 
+{
+	"input_i" : "-27.61",
+	"input_tp" : "-4.47",
+	"input_lra" : "18.06",
+	"input_thresh" : "-39.20",
+	"output_i" : "-16.58",
+	"output_tp" : "-1.50",
+	"output_lra" : "14.78",
+	"output_thresh" : "-27.71",
+	"normalization_type" : "dynamic",
+	"target_offset" : "0.58"
+}
+`
+
+func TestLoudnessFilters(t *testing.T) {
+	fake := &ffmpeg.FakeRunner{
+		Handler: func(inv ffmpeg.Invocation, stdout, stderr io.Writer) error {
+			_, err := io.WriteString(stderr, loudnormOutput)
+			return err
+		},
+	}
+	defer func(r ffmpeg.Runner) { ffmpeg.DefaultRunner = r }(ffmpeg.DefaultRunner)
+	ffmpeg.DefaultRunner = fake
+
+	cfg := testConfig("cpu")
+	cfg.LoudnessTarget, cfg.TruePeak, cfg.LoudnessRange = -23, -1, 7
+	streams := []utils.StreamInfo{
+		{Index: 0, Type: "video"},
+		{Index: 1, Type: "audio"},
+		{Index: 2, Type: "audio"},
+	}
+	chains, err := loudnessFilters(context.Background(), "in.mkv", streams, cfg, false)
+	if err != nil {
+		t.Fatalf("loudnessFilters() error = %v", err)
+	}
+
+	want := "loudnorm=I=-23:TP=-1:LRA=7:measured_I=-27.61:measured_TP=-4.47:measured_LRA=18.06:" +
+		"measured_thresh=-39.20:offset=0.58:linear=true,aresample=48000"
+	if len(chains) != 2 || chains[0].String() != want || chains[1].String() != want {
+		t.Errorf("loudnessFilters() = %v, want two chains of %q", chains, want)
+	}
+
+	// One measurement pass per audio stream
+	calls := fake.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("Calls() = %q, want two measurement passes", calls)
+	}
+	for i, stream := range []string{"0:1", "0:2"} {
+		if j := slices.Index(calls[i].Args, "-map"); j < 0 || calls[i].Args[j+1] != stream {
+			t.Errorf("pass %d args = %q, want -map %s", i, calls[i].Args, stream)
+		}
+	}
+}
+
+func TestLoudnessFiltersDryRun(t *testing.T) {
+	fake := &ffmpeg.FakeRunner{}
+	defer func(r ffmpeg.Runner) { ffmpeg.DefaultRunner = r }(ffmpeg.DefaultRunner)
+	ffmpeg.DefaultRunner = fake
+
+	cfg := testConfig("cpu")
+	cfg.LoudnessTarget, cfg.TruePeak, cfg.LoudnessRange = -16, -1.5, 11
+	cfg.DryRun = true
+	chains, err := loudnessFilters(context.Background(), "in.mkv", []utils.StreamInfo{{Index: 1, Type: "audio"}}, cfg, false)
+	if err != nil {
+		t.Fatalf("loudnessFilters() error = %v", err)
+	}
+	if want := "loudnorm=I=-16:TP=-1.5:LRA=11,aresample=48000"; len(chains) != 1 || chains[0].String() != want {
+		t.Errorf("loudnessFilters() = %v, want %q", chains, want)
+	}
+	if calls := fake.Calls(); len(calls) != 0 {
+		t.Errorf("Calls() = %q, want no measurement pass", calls)
+	}
+}
@@ -0,0 +1,35 @@
+package video
+
+import (
+	"strings"
+
+	"video_compressor/src/ffmpeg"
+	"video_compressor/src/metrics"
+)
+
+// Outcome returns the metrics of a compression that returned result and err;
+// cancelled tells whether it was stopped by a cancellation
+func Outcome(result *Result, err error, cancelled bool) metrics.Outcome {
+	o := metrics.Outcome{Status: metrics.StatusSucceeded}
+	switch {
+	case cancelled:
+		o.Status = metrics.StatusCancelled
+	case err != nil:
+		o.Status = metrics.StatusFailed
+		// runFFmpeg prefixes the errors of failed FFmpeg runs
+		if msg := err.Error(); strings.Contains(msg, "ffmpeg execution error") || strings.Contains(msg, "gpu encoder error") {
+			o.FailureReason = ffmpeg.FailureReason(msg)
+		}
+	}
+	if result == nil {
+		return o
+	}
+	o.InputSize, o.EncodeSeconds = result.InputSize, result.WallTime
+	if result.Output != "" {
+		o.OutputSize = result.OutputSize
+	}
+	if o.Status == metrics.StatusSucceeded {
+		o.Encoder, o.Speed = result.Encoder, result.Speed
+	}
+	return o
+}
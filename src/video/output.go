@@ -0,0 +1,117 @@
+package video
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"video_compressor/src/config"
+	"video_compressor/src/utils"
+)
+
+// checkOverwrite fails early if the output exists and the policy does not allow replacing it
+func checkOverwrite(outputPath string, policy config.OverwritePolicy) error {
+	if policy == config.OverwriteAlways || policy == config.OverwriteIfSmaller {
+		return nil
+	}
+	if _, err := os.Stat(outputPath); err == nil {
+		return fmt.Errorf("output file already exists: %s (use -overwrite always or if-smaller)", outputPath)
+	}
+	return nil
+}
+
+// createTempOutput creates a hidden temporary file next to outputPath for FFmpeg to write to,
+// so that the final path only ever holds a complete, verified file
+func createTempOutput(outputPath string) (string, error) {
+	dir, base := filepath.Split(outputPath)
+	ext := filepath.Ext(base)
+	f, err := os.CreateTemp(dir, "."+strings.TrimSuffix(base, ext)+".*.partial"+ext)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary output: %v", err)
+	}
+	f.Close()
+	// CreateTemp uses 0600, outputs should have regular file permissions
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to set permissions on temporary output: %v", err)
+	}
+	return f.Name(), nil
+}
+
+// verifyOutput probes the encoded file and checks its duration and streams against the
+// expected ones. An output that cannot be probed, has no video stream or has no duration
+// always fails, also when the expected properties are unknown (zero). It returns the
+// probed properties of the output.
+func verifyOutput(ctx context.Context, outputPath string, expected utils.VideoInfo) (utils.VideoInfo, error) {
+	out, err := utils.ProbeVideo(ctx, outputPath)
+	if err != nil {
+		return out, fmt.Errorf("output verification failed: %v", err)
+	}
+	if out.Duration <= 0 {
+		return out, fmt.Errorf("output verification failed: output has no duration")
+	}
+
+	// Allow for container and frame rate rounding: 1 second or 2%, whichever is larger
+	if expected.Duration > 0 {
+		tolerance := math.Max(1, expected.Duration*0.02)
+		if math.Abs(out.Duration-expected.Duration) > tolerance {
+			return out, fmt.Errorf("output verification failed: duration %.2fs, expected %.2fs",
+				out.Duration, expected.Duration)
+		}
+	}
+
+	// expected.Streams holds the source streams selected for the output
+	for _, streamType := range []string{"audio", "subtitle"} {
+		if got, want := out.CountStreams(streamType), expected.CountStreams(streamType); got < want {
+			return out, fmt.Errorf("output verification failed: %d %s streams, expected %d", got, streamType, want)
+		}
+	}
+	return out, nil
+}
+
+// commitOutput moves the verified temporary file to outputPath according to the overwrite policy.
+// It returns false if an existing output was kept; the temporary file is removed in that case.
+func commitOutput(tempPath, outputPath string, policy config.OverwritePolicy) (bool, error) {
+	existing, err := os.Stat(outputPath)
+	if err == nil {
+		switch policy {
+		case config.OverwriteAlways:
+		case config.OverwriteIfSmaller:
+			written, err := os.Stat(tempPath)
+			if err != nil {
+				return false, fmt.Errorf("failed to stat temporary output: %v", err)
+			}
+			if written.Size() >= existing.Size() {
+				os.Remove(tempPath)
+				return false, nil
+			}
+		default:
+			os.Remove(tempPath)
+			return false, fmt.Errorf("output file already exists: %s", outputPath)
+		}
+	}
+
+	if err := os.Rename(tempPath, outputPath); err != nil {
+		os.Remove(tempPath)
+		return false, fmt.Errorf("failed to move output into place: %v", err)
+	}
+	return true, nil
+}
+
+// copyFileAttrs copies the file times and, if enabled, the extended attributes of src to dst.
+// Failures are only reported since the output itself is complete.
+func copyFileAttrs(src, dst string, cfg config.VideoConfig) {
+	if cfg.PreserveMetadata {
+		if err := utils.CopyFileTimes(src, dst); err != nil {
+			fmt.Printf("Warning: cannot preserve file times: %v\n", err)
+		}
+	}
+	if cfg.CopyXattrs {
+		if err := utils.CopyXattrs(src, dst); err != nil {
+			fmt.Printf("Warning: cannot copy extended attributes: %v\n", err)
+		}
+	}
+}
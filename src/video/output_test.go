@@ -0,0 +1,72 @@
+package video
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"video_compressor/src/ffmpeg"
+	"video_compressor/src/utils"
+)
+
+// fakeProbe makes ProbeVideo return the given ffprobe JSON output
+func fakeProbe(t *testing.T, output string) {
+	// ProbeVideo looks for ffprobe in the working directory first
+	dir, wd := t.TempDir(), mustGetwd(t)
+	if err := os.WriteFile(filepath.Join(dir, "ffprobe"), nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	original := ffmpeg.DefaultRunner
+	ffmpeg.DefaultRunner = &ffmpeg.FakeRunner{
+		Handler: func(inv ffmpeg.Invocation, stdout, stderr io.Writer) error {
+			_, err := io.WriteString(stdout, output)
+			return err
+		},
+	}
+	t.Cleanup(func() {
+		ffmpeg.DefaultRunner = original
+		os.Chdir(wd)
+	})
+}
+
+func mustGetwd(t *testing.T) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wd
+}
+
+func TestVerifyOutput(t *testing.T) {
+	const videoOnly = `{"streams": [{"index": 0, "codec_type": "video", "codec_name": "hevc"}], "format": {"duration": "60.0"}}`
+	source := utils.VideoInfo{Duration: 60, Streams: []utils.StreamInfo{{Index: 0, Type: "video"}, {Index: 1, Type: "audio"}}}
+	tests := []struct {
+		name     string
+		probe    string
+		expected utils.VideoInfo
+		wantErr  bool
+	}{
+		{"matches source", `{"streams": [{"index": 0, "codec_type": "video"}, {"index": 1, "codec_type": "audio"}], "format": {"duration": "60.4"}}`, source, false},
+		{"missing audio", videoOnly, source, true},
+		{"too short", `{"streams": [{"index": 0, "codec_type": "video"}, {"index": 1, "codec_type": "audio"}], "format": {"duration": "30"}}`, source, true},
+		// Without a source probe the output is still checked on its own
+		{"unknown source", videoOnly, utils.VideoInfo{}, false},
+		{"unknown source, no duration", `{"streams": [{"index": 0, "codec_type": "video"}], "format": {}}`, utils.VideoInfo{}, true},
+		{"unknown source, no video", `{"streams": [{"index": 0, "codec_type": "audio"}], "format": {"duration": "60"}}`, utils.VideoInfo{}, true},
+		{"unreadable output", `not json`, utils.VideoInfo{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeProbe(t, tt.probe)
+			_, err := verifyOutput(context.Background(), "out.mp4", tt.expected)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verifyOutput() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
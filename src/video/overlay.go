@@ -0,0 +1,110 @@
+package video
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"video_compressor/src/config"
+	"video_compressor/src/ffmpeg"
+	"video_compressor/src/filtergraph"
+	"video_compressor/src/utils"
+)
+
+// overlayPlan holds the resolved overlays of an output
+type overlayPlan struct {
+	text  string // Expanded drawtext text ("" for none)
+	width int    // Output width, used to scale the watermark
+}
+
+// hasOverlays reports whether any overlay is configured
+func hasOverlays(cfg config.VideoConfig) bool {
+	return cfg.Watermark != "" || cfg.Text != ""
+}
+
+// overlayText expands the placeholders of a text template: {filename}, {date} (YYYY-MM-DD)
+// and {timecode} (the running position as HH:MM:SS.mmm)
+func overlayText(template, filename string, date time.Time) string {
+	// drawtext treats % as the start of an expansion
+	literal := func(s string) string {
+		return strings.ReplaceAll(s, "%", `\%`)
+	}
+	parts := strings.Split(template, "{timecode}")
+	for i, p := range parts {
+		p = strings.ReplaceAll(p, "{filename}", filename)
+		p = strings.ReplaceAll(p, "{date}", date.Format("2006-01-02"))
+		parts[i] = literal(p)
+	}
+	return strings.Join(parts, "%{pts:hms}")
+}
+
+// sourceDate returns the recording date of a source: its creation_time tag if present,
+// otherwise the modification time of the file
+func sourceDate(path string, source utils.VideoInfo) time.Time {
+	if t, err := time.Parse(time.RFC3339Nano, source.CreationTime); err == nil {
+		return t
+	}
+	if fi, err := os.Stat(path); err == nil {
+		return fi.ModTime()
+	}
+	return time.Now()
+}
+
+// applyOverlays adds the configured watermark and text after the video filters of out.
+// A watermark is an extra input, so the video filters move into a complex filtergraph
+// whose output replaces the video map (video is its map specifier, "" for default selection).
+func applyOverlays(cmd *ffmpeg.Command, out *ffmpeg.Output, video string, cfg config.VideoConfig, plan overlayPlan) {
+	var text []filtergraph.Filter
+	if plan.text != "" {
+		text = append(text, ffmpeg.DrawTextFilter(plan.text, cfg.TextPosition, cfg.WatermarkMargin, cfg.TextSize, cfg.TextFontFile))
+	}
+	if cfg.Watermark == "" {
+		if len(text) > 0 {
+			if out.VideoFilters == nil {
+				out.VideoFilters = filtergraph.NewChain()
+			}
+			out.VideoFilters.Append(text...)
+		}
+		return
+	}
+
+	input := "0:v:0"
+	if video != "" {
+		input = video
+	}
+	graph := &filtergraph.Graph{}
+	base := input
+	if !out.VideoFilters.Empty() {
+		base = "base"
+		graph.Add(filtergraph.NewChain(input).Append(out.VideoFilters.Filters...).To(base))
+	}
+	out.VideoFilters = nil
+
+	watermarkInput := len(cmd.Inputs)
+	cmd.AddInput(cfg.Watermark)
+	width := 0
+	if cfg.WatermarkScale > 0 && plan.width > 0 {
+		// Keep the width even for chroma subsampled formats
+		width = int(float64(plan.width)*cfg.WatermarkScale) &^ 1
+	}
+	graph.Add(filtergraph.NewChain(fmt.Sprintf("%d:v", watermarkInput)).
+		Append(ffmpeg.WatermarkFilters(width, cfg.WatermarkOpacity)...).
+		To("wm"))
+	graph.Add(filtergraph.NewChain(base, "wm").
+		Append(ffmpeg.OverlayFilter(cfg.WatermarkPosition, cfg.WatermarkMargin)).
+		Append(text...).
+		To("vout"))
+	cmd.FilterGraph = graph
+
+	// Replace the video stream with the filtergraph output
+	mapped := false
+	for i, m := range out.Maps {
+		if m == video {
+			out.Maps[i], mapped = "[vout]", true
+		}
+	}
+	if !mapped {
+		out.Maps = append([]string{"[vout]", "0:a?"}, out.Maps...)
+	}
+}
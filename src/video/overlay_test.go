@@ -0,0 +1,54 @@
+package video
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"video_compressor/src/utils"
+)
+
+func TestOverlayText(t *testing.T) {
+	date := time.Date(2024, 5, 1, 23, 30, 0, 0, time.UTC)
+	tests := []struct {
+		template string
+		filename string
+		want     string
+	}{
+		{"{filename}", "holiday.mp4", "holiday.mp4"},
+		{"{filename} {date}", "holiday.mp4", "holiday.mp4 2024-05-01"},
+		{"{timecode}", "holiday.mp4", "%{pts:hms}"},
+		{"Rec {date} {timecode} / {timecode}", "holiday.mp4", "Rec 2024-05-01 %{pts:hms} / %{pts:hms}"},
+		// A literal % must not start a drawtext expansion
+		{"100% {filename}", "50%.mp4", `100\% 50\%.mp4`},
+		{"{unknown} text", "holiday.mp4", "{unknown} text"},
+	}
+	for _, tt := range tests {
+		if got := overlayText(tt.template, tt.filename, date); got != tt.want {
+			t.Errorf("overlayText(%q, %q) = %q, want %q", tt.template, tt.filename, got, tt.want)
+		}
+	}
+}
+
+func TestSourceDate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.mp4")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	modified := time.Date(2023, 8, 15, 10, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+
+	tagged := utils.VideoInfo{CreationTime: "2024-05-01T12:00:00.000000Z"}
+	if got, want := sourceDate(path, tagged), time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("tagged source date = %v, want the creation time %v", got, want)
+	}
+	if got := sourceDate(path, utils.VideoInfo{CreationTime: "yesterday"}); !got.Equal(modified) {
+		t.Errorf("source date with an invalid tag = %v, want the modification time %v", got, modified)
+	}
+	if got := sourceDate(path+".missing", utils.VideoInfo{}); time.Since(got) > time.Minute {
+		t.Errorf("source date of a missing file = %v, want now", got)
+	}
+}
@@ -1,31 +1,60 @@
 package video
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"sort"
-	"strconv"
 	"strings"
+	"time"
 
 	"video_compressor/src/config"
 	"video_compressor/src/ffmpeg"
+	"video_compressor/src/filtergraph"
 	"video_compressor/src/utils"
 
 	"github.com/fvbommel/sortorder"
 )
 
-// CompressVideo compresses the video using ffmpeg
-func CompressVideo(inputPath, outputPath string, cfg config.VideoConfig, verbose bool) error {
+// CompressVideo compresses the video using ffmpeg and reports what was done.
+// The result is returned on failure too, with the failure as its reason.
+func CompressVideo(ctx context.Context, inputPath, outputPath string, cfg config.VideoConfig, verbose bool) (*Result, error) {
+	start := time.Now()
+	result := &Result{Input: inputPath}
+	err := compressVideo(ctx, inputPath, outputPath, cfg, verbose, result)
+	result.WallTime = time.Since(start).Seconds()
+	if err != nil {
+		result.Decision, result.Reason = DecisionFailed, err.Error()
+		return result, err
+	}
+	return result, nil
+}
+
+// compressJob is an analyzed input, ready to be encoded
+type compressJob struct {
+	inputPath  string
+	outputPath string // With the output extension
+	ext        string
+	cfg        config.VideoConfig // With the computed dimensions and bitrate
+	plan       compressPlan
+	source     utils.VideoInfo
+	probed     bool            // The source was probed; source holds its properties
+	expected   utils.VideoInfo // Expected properties of the output
+}
+
+// planCompress validates and analyzes an input and decides how to encode it.
+// It returns a nil job if the input is skipped; result holds the decision.
+func planCompress(ctx context.Context, inputPath, outputPath string, cfg config.VideoConfig, verbose bool, result *Result) (*compressJob, error) {
 	// Check if the video file is valid
-	if !utils.IsVideoFileValid(inputPath) {
-		return fmt.Errorf("invalid video file: %s", inputPath)
+	if !utils.IsVideoFileValid(ctx, inputPath) {
+		return nil, fmt.Errorf("invalid video file: %s", inputPath)
 	}
 
 	// Validate input format
 	if !ffmpeg.IsSupportedFormat(inputPath) {
-		return fmt.Errorf(
+		return nil, fmt.Errorf(
 			"unsupported input format; supported: MP4, AVI, MKV, MOV, WMV, FLV, WEBM",
 		)
 	}
@@ -36,7 +65,7 @@ func CompressVideo(inputPath, outputPath string, cfg config.VideoConfig, verbose
 		ext = "." + ext
 	}
 	if !ffmpeg.SupportedFormats[ext] {
-		return fmt.Errorf(
+		return nil, fmt.Errorf(
 			"unsupported output extension %q; supported: %v",
 			ext, ffmpeg.SupportedFormatsKeys(),
 		)
@@ -44,84 +73,459 @@ func CompressVideo(inputPath, outputPath string, cfg config.VideoConfig, verbose
 	if filepath.Ext(outputPath) != ext {
 		outputPath += ext
 	}
+	if err := checkOverwrite(outputPath, cfg.Overwrite); err != nil {
+		return nil, err
+	}
+	if cfg.BurnSubtitles != "" {
+		if _, err := os.Stat(cfg.BurnSubtitles); err != nil {
+			return nil, fmt.Errorf("subtitle file not found: %s", cfg.BurnSubtitles)
+		}
+	}
+	if cfg.Watermark != "" {
+		if _, err := os.Stat(cfg.Watermark); err != nil {
+			return nil, fmt.Errorf("watermark image not found: %s", cfg.Watermark)
+		}
+	}
 
 	// Get original file size
 	origSize, err := utils.GetVideoSize(inputPath)
 	if err != nil {
-		return fmt.Errorf("failed to get input file size: %v", err)
+		return nil, fmt.Errorf("failed to get input file size: %v", err)
 	}
+	result.InputSize = origSize
 
-	// Auto-calculate width and height if needed
-	if cfg.Resolution != config.ResolutionNone && cfg.Width == 0 && cfg.Height == 0 {
-		ow, oh, e := utils.GetVideoDimensions(inputPath)
+	// Probe the source for skip rules, HDR detection and output verification
+	source, probeErr := utils.ProbeVideo(ctx, inputPath)
+	if probeErr != nil {
+		fmt.Printf("Warning: cannot probe source properties: %v\n", probeErr)
+	} else {
+		result.Source = &source
+	}
+
+	// Detect black borders if requested
+	var crop *utils.CropRect
+	if cfg.AutoCrop {
+		ow, oh, e := utils.GetVideoDimensions(ctx, inputPath)
+		if e == nil {
+			var rect utils.CropRect
+			rect, e = utils.DetectCrop(ctx, cfg.FfmpegPath, inputPath)
+			if e == nil && (rect.Width < ow || rect.Height < oh) {
+				crop = &rect
+				if verbose {
+					fmt.Printf("Detected crop: %dx%d at %d,%d (source %dx%d)\n",
+						rect.Width, rect.Height, rect.X, rect.Y, ow, oh)
+				}
+			}
+		}
+		if e != nil {
+			fmt.Printf("Warning: cannot detect crop, keeping full frame: %v\n", e)
+		}
+	}
+
+	// Auto-calculate width and height if needed. Custom dimensions are bounded by the
+	// scale policy and max-width/max-height like the ones of a resolution.
+	custom := cfg.Width > 0 && cfg.Height > 0
+	if custom || cfg.Resolution != config.ResolutionNone {
+		ow, oh, e := utils.GetVideoDimensions(ctx, inputPath)
 		if e != nil {
 			fmt.Printf("Warning: cannot get dimensions: %v\n", e)
 		}
-		w, h, br := utils.GetRecommendedSettings(cfg.Resolution, ow, oh)
-		cfg.Width, cfg.Height, cfg.Bitrate = w, h, br
+		// Use the cropped aspect ratio for the target dimensions
+		if crop != nil {
+			ow, oh = crop.Width, crop.Height
+		}
+		w, h, br := cfg.Width, cfg.Height, cfg.Bitrate
+		if !custom {
+			w, h, br = utils.GetRecommendedSettings(cfg.Resolution, ow, oh)
+		}
+		cfg.Width, cfg.Height = utils.ConstrainDimensions(cfg, w, h, ow, oh)
+		cfg.Bitrate = br
+		// Lower the bitrate if the dimensions were reduced by the scale policy
+		if cfg.Width != w || cfg.Height != h {
+			if custom {
+				fmt.Printf("Custom size %dx%d reduced to %dx%d by the scale policy and size bounds\n",
+					w, h, cfg.Width, cfg.Height)
+			}
+			if br > 0 {
+				cfg.Bitrate = min(br, utils.GetRecommendedBitrate(cfg.Width, cfg.Height))
+			}
+		}
 	}
 
-	// Build ffmpeg arguments
-	// Set input file
-	args := []string{"-i", inputPath}
+	// Detect HDR sources
+	hdrSource := cfg.HDRMode != config.HDROff && source.IsHDR()
+	transfer := source.ColorTransfer
+	preserveHDR := hdrSource && cfg.HDRMode == config.HDRPreserve
+	if preserveHDR && !ffmpeg.HDRSupportedExt[ext] {
+		fmt.Printf("Warning: %s cannot carry HDR video, tone mapping to SDR instead.\n", ext)
+		preserveHDR = false
+	}
+	toneMap := hdrSource && !preserveHDR
+
+	// Resolve the encoder once, so that the GPU fallback is reported once per input
+	var codecArgs []string
+	if preserveHDR {
+		codecArgs = ffmpeg.DetermineHDRCodec(ext, cfg, transfer)
+	} else {
+		cfg.Encoder = ffmpeg.ResolveEncoder(ext, cfg.Encoder)
+		codecArgs = ffmpeg.DetermineCodec(ext, cfg)
+	}
+
+	// Skip inputs that would not benefit from re-encoding
+	if probeErr == nil {
+		if reason := skipReason(source, ffmpeg.CodecName(codecArgs), cfg); reason != "" {
+			result.Decision, result.Reason = DecisionSkipped, reason
+			if verbose || cfg.DryRun {
+				fmt.Printf("Skipping %s: %s\n", inputPath, reason)
+			}
+			if cfg.DryRun {
+				return nil, nil
+			}
+			result.Output, err = keepOriginal(inputPath, outputPath, ext, cfg)
+			if result.Output != "" {
+				result.OutputSize = origSize
+			}
+			return nil, err
+		}
+	}
+
+	if verbose && hdrSource {
+		if preserveHDR {
+			fmt.Printf("HDR source detected (%s), preserving HDR\n", transfer)
+		} else {
+			fmt.Printf("HDR source detected (%s), tone mapping to SDR\n", transfer)
+		}
+	}
+
+	// Detect interlaced sources
+	deinterlace := cfg.Deinterlace == config.DeinterlaceOn
+	if cfg.Deinterlace == config.DeinterlaceAuto {
+		interlaced, e := utils.DetectInterlace(ctx, cfg.FfmpegPath, inputPath)
+		if e != nil {
+			fmt.Printf("Warning: cannot detect interlacing: %v\n", e)
+		}
+		deinterlace = interlaced
+		if verbose && interlaced {
+			fmt.Println("Interlaced source detected, deinterlacing")
+		}
+	}
+
+	// Build and run the FFmpeg command
+	plan := compressPlan{
+		crop:        crop,
+		deinterlace: deinterlace,
+		toneMap:     toneMap,
+		preserveHDR: preserveHDR,
+		transfer:    transfer,
+		rotated:     source.Rotation != 0,
+	}
+	if plan.burnSubtitles, err = burnSubtitlesFilter(inputPath, source, cfg); err != nil {
+		return nil, err
+	}
+	burned := 0 // Embedded subtitle track burned into the picture
+	if plan.burnSubtitles != nil && cfg.BurnSubtitles == "" {
+		burned = cfg.BurnSubtitleTrack
+	}
+	// Keep the default stream selection if the streams are unknown
+	expected := source
+	if probeErr == nil {
+		var sidecars []sidecarSubtitle
+		if cfg.SidecarSubtitles {
+			sidecars = findSidecarSubtitles(inputPath)
+			if verbose {
+				for _, sc := range sidecars {
+					fmt.Printf("Adding subtitle file %s (%s)\n", sc.path, sc.language)
+				}
+			}
+		}
+		plan.streams = selectStreams(source, ext, cfg, sidecars, burned)
+		expected.Streams = plan.streams.streams
+	}
+	if cfg.Loudnorm {
+		if probeErr != nil {
+			fmt.Println("Warning: audio streams unknown, skipping loudness normalization")
+		} else if plan.loudness, err = loudnessFilters(ctx, inputPath, plan.streams.streams, cfg, verbose); err != nil {
+			return nil, err
+		}
+	}
+	if hasOverlays(cfg) {
+		plan.overlay.width = cfg.Width
+		if plan.overlay.width == 0 {
+			plan.overlay.width, _ = source.DisplayDimensions()
+			if crop != nil {
+				plan.overlay.width = crop.Width
+			}
+		}
+		if cfg.Text != "" {
+			plan.overlay.text = overlayText(cfg.Text, filepath.Base(inputPath), sourceDate(inputPath, source))
+		}
+	}
+	return &compressJob{
+		inputPath:  inputPath,
+		outputPath: outputPath,
+		ext:        ext,
+		cfg:        cfg,
+		plan:       plan,
+		source:     source,
+		probed:     probeErr == nil,
+		expected:   expected,
+	}, nil
+}
+
+// compressVideo does the work of CompressVideo, filling in result
+func compressVideo(ctx context.Context, inputPath, outputPath string, cfg config.VideoConfig, verbose bool, result *Result) error {
+	job, err := planCompress(ctx, inputPath, outputPath, cfg, verbose, result)
+	if err != nil || job == nil {
+		return err
+	}
+	outputPath, ext, cfg, plan, source := job.outputPath, job.ext, job.cfg, job.plan, job.source
+	origSize := result.InputSize
+
+	if cfg.DryRun {
+		cmd := buildCompressCommand(inputPath, outputPath, ext, cfg, plan)
+		result.Command, result.Encoder = cmd.ShellString(), videoEncoder(cmd)
+		result.Decision, result.Output = DecisionPlanned, outputPath
+		printPlan(inputPath, source, cfg, cmd)
+		return nil
+	}
+
+	// Encode into a temporary file next to the output; it is removed unless committed
+	tempPath, err := createTempOutput(outputPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempPath)
+
+	cmd := buildCompressCommand(inputPath, tempPath, ext, cfg, plan)
+	result.Command, result.Encoder = cmd.ShellString(), videoEncoder(cmd)
+	encodeStart := time.Now()
+	if err := runFFmpeg(ctx, cmd, cfg, verbose); err != nil {
+		return err
+	}
+	if elapsed := time.Since(encodeStart).Seconds(); elapsed > 0 {
+		result.Speed = source.Duration / elapsed
+	}
+
+	// Verify the encode before it replaces anything. Without a source probe the output
+	// is only checked on its own.
+	info, err := verifyOutput(ctx, tempPath, job.expected)
+	if err != nil {
+		return err
+	}
+	result.OutputInfo = &info
+	newSize, err := utils.GetVideoSize(tempPath)
+	if err != nil {
+		return fmt.Errorf("failed to get output file size: %v", err)
+	}
+	copyFileAttrs(inputPath, tempPath, cfg)
+
+	// Discard outputs that do not save enough
+	if savingTooSmall(origSize, newSize, cfg) {
+		result.Decision = DecisionDiscarded
+		result.Reason = fmt.Sprintf("saving %.2f%% is below %.2f%%",
+			(1-float64(newSize)/float64(origSize))*100, cfg.MinSavingPercent)
+		if verbose {
+			fmt.Printf("Discarding output of %s: %s\n", inputPath, result.Reason)
+		}
+		result.Output, err = keepOriginal(inputPath, outputPath, ext, cfg)
+		if result.Output != "" {
+			result.OutputSize = origSize
+		}
+		return err
+	}
+
+	replaced, err := commitOutput(tempPath, outputPath, cfg.Overwrite)
+	if err != nil {
+		return err
+	}
+	if !replaced {
+		fmt.Printf("Existing output %s is smaller, keeping it\n", outputPath)
+		result.Decision, result.Reason = DecisionKeptExisting, "existing output is smaller"
+		return nil
+	}
+	result.Decision, result.Output, result.OutputSize = DecisionEncoded, outputPath, newSize
+
+	// Show statistics
+	if verbose {
+		fmt.Println("Compression completed!")
+		fmt.Printf(
+			"Original: %.2fMB, Compressed: %.2fMB, Reduction: %.2f%%\n",
+			float64(origSize)/1024/1024,
+			float64(newSize)/1024/1024,
+			result.Reduction(),
+		)
+	}
+	return nil
+}
+
+// compressPlan holds the decisions made while analyzing an input
+type compressPlan struct {
+	crop        *utils.CropRect
+	deinterlace bool
+	toneMap     bool
+	preserveHDR bool
+	transfer    string // Color transfer of an HDR source
+	rotated     bool   // The source has a display rotation, which FFmpeg applies to the frames
+	streams     streamSelection
+	// Subtitles filter burning subtitles into the picture (nil for none)
+	burnSubtitles *filtergraph.Filter
+	overlay       overlayPlan
+	// Loudness normalization filters for each output audio stream
+	loudness []*filtergraph.Chain
+}
+
+// buildCompressCommand builds the FFmpeg command that encodes inputPath into outputPath
+func buildCompressCommand(inputPath, outputPath, ext string, cfg config.VideoConfig, plan compressPlan) *ffmpeg.Command {
+	cmd := ffmpeg.NewCommand(cfg.FfmpegPath, "-y").AddInput(inputPath)
+	for _, in := range plan.streams.inputs {
+		cmd.AddInput(in)
+	}
+	out := cmd.AddOutput(outputPath)
+
 	// Determine codec and bitrate
-	args = append(args, ffmpeg.DetermineCodec(ext, cfg)...)
+	if plan.preserveHDR {
+		out.Codec(ffmpeg.DetermineHDRCodec(ext, cfg, plan.transfer)...)
+	} else {
+		out.Codec(ffmpeg.DetermineCodec(ext, cfg)...)
+	}
+	out.Map(plan.streams.maps...)
+	out.Codec(plan.streams.args...)
+	for i, chain := range plan.loudness {
+		out.Option(fmt.Sprintf("-filter:a:%d", i), chain.String())
+	}
+	if plan.toneMap {
+		out.Option(ffmpeg.SDRColorArgs()...)
+	}
 	// Set fps
-	args = append(args, "-r", strconv.Itoa(cfg.Fps))
+	out.Option(ffmpeg.DetermineFrameRate(cfg)...)
+	if cfg.PreserveMetadata {
+		out.Option(ffmpeg.MetadataArgs(ext, plan.rotated)...)
+	}
+
+	// Build video filters: deinterlace, crop, denoise, tone map, subtitles, then scale
+	filters := filtergraph.NewChain()
+	if plan.deinterlace {
+		filters.Append(ffmpeg.DeinterlaceFilter(cfg.DeinterlaceFilter))
+	}
+	if plan.crop != nil {
+		filters.Append(filtergraph.New("crop", plan.crop.Width, plan.crop.Height, plan.crop.X, plan.crop.Y))
+	}
+	if denoise, ok := ffmpeg.DenoiseFilter(cfg.DenoiseFilter, cfg.Denoise); ok {
+		filters.Append(denoise)
+	}
+	// Tone map HDR to SDR before scaling
+	if plan.toneMap {
+		filters.Append(ffmpeg.ToneMapFilters(cfg.ToneMapOperator)...)
+	}
+	// Burn subtitles at source resolution so they are scaled with the picture
+	if plan.burnSubtitles != nil {
+		filters.Append(*plan.burnSubtitles)
+	}
 	// Scale if width and height are set
 	if cfg.Width > 0 && cfg.Height > 0 {
-		args = append(args, "-vf", fmt.Sprintf("scale=%d:%d", cfg.Width, cfg.Height))
+		filters.Append(filtergraph.New("scale", cfg.Width, cfg.Height))
 	}
+	out.VideoFilters = filters
+	// Overlays are placed on the scaled picture
+	applyOverlays(cmd, out, plan.streams.video, cfg, plan.overlay)
+
 	// Set container
-	// Get the muxer name by removing the leading dot from the extension (e.g., ".mkv" becomes "mkv")
-	muxer := strings.TrimPrefix(ext, ".")
-	switch muxer {
-	case "mkv":
-		muxer = "matroska"
-	case "ts":
-		muxer = "mpegts"
-	case "wmv":
-		muxer = "asf"
-	}
-	args = append(args, "-f", muxer)
-	// Overwrite output file
-	args = append(args, outputPath, "-y")
-
-	// Run FFmpeg
-	cmd := exec.Command(cfg.FfmpegPath, args...)
+	out.Format = ffmpeg.MuxerName(ext)
+	return cmd
+}
+
+// mergePlan holds the decisions made while encoding the segments of a merge
+type mergePlan struct {
+	hdrTransfer  string // Color transfer of preserved HDR segments ("" for SDR)
+	creationTime string // Earliest creation_time of the sources ("" if unknown)
+	overlay      overlayPlan
+}
+
+// buildMergeCommand builds the FFmpeg command that concatenates the segments in listFile
+func buildMergeCommand(listFile, outputPath, ext string, cfg config.VideoConfig, plan mergePlan) *ffmpeg.Command {
+	cmd := ffmpeg.NewCommand(cfg.FfmpegPath, "-y").AddInput(listFile, "-f", "concat", "-safe", "0")
+	out := cmd.AddOutput(outputPath)
+	out.VideoFilters = filtergraph.NewChain().Append(
+		filtergraph.New("scale", cfg.Width, cfg.Height).With("force_original_aspect_ratio", "decrease"),
+		filtergraph.New("pad", cfg.Width, cfg.Height, "(ow-iw)/2", "(oh-ih)/2"),
+		filtergraph.New("setsar", 1),
+	)
+	// Insert codec+bitrate parameters, keeping HDR if the segments preserved it
+	if plan.hdrTransfer != "" {
+		out.Codec(ffmpeg.DetermineHDRCodec(ext, cfg, plan.hdrTransfer)...)
+	} else {
+		out.Codec(ffmpeg.DetermineCodec(ext, cfg)...)
+	}
+	if cfg.OverlayScope == config.OverlayOutput {
+		applyOverlays(cmd, out, "", cfg, plan.overlay)
+	}
+	// The concat demuxer drops the container metadata of the sources
+	if cfg.PreserveMetadata && plan.creationTime != "" {
+		out.Option("-metadata", "creation_time="+plan.creationTime)
+	}
+	// Force container
+	out.Format = ffmpeg.MuxerName(ext)
+	return cmd
+}
+
+// runFFmpeg runs an encoding command, streaming FFmpeg's output if verbose.
+// Errors include the last line of FFmpeg's log.
+func runFFmpeg(ctx context.Context, cmd *ffmpeg.Command, cfg config.VideoConfig, verbose bool) error {
+	var stdout io.Writer
+	log := &ffmpeg.TailBuffer{Size: 4096}
+	var stderr io.Writer = log
 	if verbose {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+		stdout, stderr = os.Stdout, io.MultiWriter(os.Stderr, log)
 		fmt.Println("FFmpeg command:", cmd.String())
 	}
-	if err := cmd.Run(); err != nil {
+	if onProgress, ok := ctx.Value(progressKey{}).(func(ffmpeg.Progress)); ok {
+		stderr = io.MultiWriter(stderr, &ffmpeg.ProgressWriter{OnProgress: onProgress})
+	}
+	if err := ffmpeg.DefaultRunner.Run(ctx, cmd, stdout, stderr); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if line := log.LastLine(); line != "" {
+			err = fmt.Errorf("%v: %s", err, line)
+		}
 		// Show warning if GPU encoding fails
-		if cfg.Encoder == "gpu" && strings.Contains(err.Error(), "hevc_nvenc") {
+		if cfg.Encoder == "gpu" && strings.Contains(log.String(), "nvenc") {
 			fmt.Println("Warning: NVIDIA GPU encoding failed. Please retry with CPU encoder.")
 			return fmt.Errorf("gpu encoder error: %v", err)
 		}
 		return fmt.Errorf("ffmpeg execution error: %v", err)
 	}
+	return nil
+}
 
-	// Show statistics
-	newSize, err := utils.GetVideoSize(outputPath)
-	if err != nil {
-		return fmt.Errorf("failed to get output file size: %v", err)
+// progressKey is the context key of the function set by WithProgress
+type progressKey struct{}
+
+// WithProgress returns a context whose FFmpeg encodes report their progress to onProgress.
+// Merges report every segment encode from the start.
+func WithProgress(ctx context.Context, onProgress func(ffmpeg.Progress)) context.Context {
+	return context.WithValue(ctx, progressKey{}, onProgress)
+}
+
+// MergeVideos reencodes and merges all .ts and .mp4 files in the given directory.
+// The result is returned on failure too, with the failure as its reason.
+func MergeVideos(ctx context.Context, inputDir, outputPath string, cfg config.VideoConfig, verbose bool) (*Result, error) {
+	start := time.Now()
+	result := &Result{Input: inputDir}
+	err := mergeVideos(ctx, inputDir, outputPath, cfg, verbose, result)
+	result.WallTime = time.Since(start).Seconds()
+	if result.OutputInfo != nil && result.WallTime > 0 {
+		result.Speed = result.OutputInfo.Duration / result.WallTime
 	}
-	if verbose {
-		fmt.Println("Compression completed!")
-		fmt.Printf(
-			"Original: %.2fMB, Compressed: %.2fMB, Reduction: %.2f%%\n",
-			float64(origSize)/1024/1024,
-			float64(newSize)/1024/1024,
-			(1-float64(newSize)/float64(origSize))*100,
-		)
+	if err != nil {
+		result.Decision, result.Reason = DecisionFailed, err.Error()
+		return result, err
 	}
-	return nil
+	return result, nil
 }
 
-// MergeVideos reencodes and merges all .ts and .mp4 files in the given directory
-func MergeVideos(inputDir, outputPath string, cfg config.VideoConfig) error {
+// mergeVideos does the work of MergeVideos, filling in result
+func mergeVideos(ctx context.Context, inputDir, outputPath string, cfg config.VideoConfig, verbose bool, result *Result) error {
 	// Handle and validate output file extension
 	ext := strings.ToLower(cfg.OutputExtension)
 	if !strings.HasPrefix(ext, ".") {
@@ -133,9 +537,12 @@ func MergeVideos(inputDir, outputPath string, cfg config.VideoConfig) error {
 	if filepath.Ext(outputPath) != ext {
 		outputPath += ext
 	}
+	if err := checkOverwrite(outputPath, cfg.Overwrite); err != nil {
+		return err
+	}
 
 	// Analyze minimum width/height ratio
-	ratio, err := utils.AnalyzeVideoRatios(inputDir, "min")
+	ratio, err := utils.AnalyzeVideoRatios(ctx, inputDir, "min")
 	if err != nil {
 		return fmt.Errorf("failed to analyze video dimensions: %v", err)
 	}
@@ -145,6 +552,18 @@ func MergeVideos(inputDir, outputPath string, cfg config.VideoConfig) error {
 		fmt.Println("No resolution specified, defaulting to 1080p")
 		cfg.Width, cfg.Height = utils.GetResolutionDimensionsRatio(config.Resolution1080p, ratio)
 	}
+	// Apply the scale policy against the largest input
+	maxW, maxH, err := utils.GetMaxDimensions(ctx, inputDir)
+	if err != nil {
+		fmt.Printf("Warning: cannot get source dimensions: %v\n", err)
+	}
+	if w, h := utils.ConstrainDimensions(cfg, cfg.Width, cfg.Height, maxW, maxH); w != cfg.Width || h != cfg.Height {
+		cfg.Width, cfg.Height = w, h
+		// Lower the bitrate to match the reduced dimensions
+		if cfg.Bitrate > 0 {
+			cfg.Bitrate = min(cfg.Bitrate, utils.GetRecommendedBitrate(w, h))
+		}
+	}
 	fmt.Printf("Using resolution: %dx%d (ratio %.3f)\n", cfg.Width, cfg.Height, ratio)
 
 	// Create temporary directory
@@ -186,8 +605,11 @@ func MergeVideos(inputDir, outputPath string, cfg config.VideoConfig) error {
 		})
 	}
 
-	// Print first 20 files after sorting
+	// Print first 20 files after sorting, or all of them for a dry run
 	maxShow := 20
+	if cfg.DryRun {
+		maxShow = len(files)
+	}
 	fmt.Printf("First %d files after sorting:\n", min(len(files), maxShow))
 	for i, name := range files[:min(len(files), maxShow)] {
 		fmt.Printf("  %d: %s\n", i+1, name)
@@ -198,19 +620,69 @@ func MergeVideos(inputDir, outputPath string, cfg config.VideoConfig) error {
 	var sb strings.Builder
 	fmt.Println("Step 1: Re-encoding individual files...")
 	successCount := 0
+	var firstSegment string
+	var expected utils.VideoInfo // Expected properties of the merged output
+	// Every segment must be encoded for the concat step, so the re-encode safeguards are off
+	segmentCfg := cfg
+	segmentCfg.Overwrite = config.OverwriteAlways
+	segmentCfg.SkipBelowBpp = 0
+	segmentCfg.SkipTargetCodec = false
+	segmentCfg.KeepAllOutputs = true
+	segmentCfg.CopyXattrs = false
+	// Concatenation needs the same streams in every segment
+	segmentCfg.Audio = config.AudioFirst
+	segmentCfg.Subtitles = config.SubtitlesDrop
+	segmentCfg.SidecarSubtitles = false
+	// Overlays over the merged output are applied in the merge step
+	if cfg.OverlayScope == config.OverlayOutput {
+		segmentCfg.Watermark, segmentCfg.Text = "", ""
+	}
+	// A subtitle file belongs to a single video
+	if segmentCfg.BurnSubtitles != "" {
+		fmt.Println("Warning: -burn-subtitles is ignored when merging, use -burn-subtitle-track")
+		segmentCfg.BurnSubtitles = ""
+	}
+	var plan mergePlan
+	var oldestSource string // Source with the earliest modification time
+	var oldestModTime time.Time
 	for i, name := range files {
 		in := filepath.Join(inputDir, name)
 		tempOut := filepath.Join(tempDir, fmt.Sprintf("seg_%03d.%s", i, cfg.OutputExtension))
 		fmt.Printf("  [%d/%d] %s → %s\n", i+1, len(files), name, filepath.Base(tempOut))
-		if !utils.IsVideoFileValid(in) {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !utils.IsVideoFileValid(ctx, in) {
 			fmt.Printf("❌ Invalid video file: %s\n", in)
 			continue
 		}
-		if err := CompressVideo(in, tempOut, cfg, false); err != nil {
+		// The merged output takes the earliest creation and modification time of its sources
+		if info, err := utils.ProbeVideo(ctx, in); err == nil && info.CreationTime != "" {
+			if plan.creationTime == "" || earlierTimestamp(info.CreationTime, plan.creationTime) {
+				plan.creationTime = info.CreationTime
+			}
+		}
+		fi, err := os.Stat(in)
+		if err == nil && (oldestSource == "" || fi.ModTime().Before(oldestModTime)) {
+			oldestSource, oldestModTime = in, fi.ModTime()
+		}
+		if _, err := CompressVideo(ctx, in, tempOut, segmentCfg, false); err != nil {
 			fmt.Printf("❌ Error processing %s: %v\n", name, err)
 			continue
 		}
 		sb.WriteString(fmt.Sprintf("file '%s'\n", tempOut))
+		if fi != nil {
+			result.InputSize += fi.Size()
+		}
+		if info, err := utils.ProbeVideo(ctx, tempOut); err == nil {
+			expected.Duration += info.Duration
+			if successCount == 0 {
+				expected.Streams = info.Streams
+			}
+		}
+		if successCount == 0 {
+			firstSegment = tempOut
+		}
 		successCount++
 	}
 
@@ -227,30 +699,100 @@ func MergeVideos(inputDir, outputPath string, cfg config.VideoConfig) error {
 
 	// Merge re-encoded segments
 	fmt.Println("Step 2: Merging re-encoded segments...")
-	filter := fmt.Sprintf(
-		"scale=%d:%d:force_original_aspect_ratio=decrease,"+
-			"pad=%d:%d:(ow-iw)/2:(oh-ih)/2,setsar=1",
-		cfg.Width, cfg.Height, cfg.Width, cfg.Height,
-	)
-	args := []string{
-		"-f", "concat", "-safe", "0",
-		"-i", listFile,
-		"-vf", filter,
-	}
-	// Insert codec+bitrate parameters
-	args = append(args, ffmpeg.DetermineCodec(ext, cfg)...)
-	// Force container, overwrite
-	args = append(args,
-		"-f", strings.TrimPrefix(ext, "."), outputPath, "-y",
-	)
+	if cfg.HDRMode == config.HDRPreserve {
+		if info, err := utils.ProbeVideo(ctx, firstSegment); err == nil && info.IsHDR() {
+			plan.hdrTransfer = info.ColorTransfer
+		}
+	}
+	if hasOverlays(cfg) && cfg.OverlayScope == config.OverlayOutput {
+		plan.overlay.width = cfg.Width
+		date := time.Now()
+		if t, err := time.Parse(time.RFC3339Nano, plan.creationTime); err == nil {
+			date = t
+		}
+		plan.overlay.text = overlayText(cfg.Text, filepath.Base(outputPath), date)
+	}
+	if cfg.DryRun {
+		cmd := buildMergeCommand(listFile, outputPath, ext, cfg, plan)
+		result.Command, result.Encoder = cmd.ShellString(), videoEncoder(cmd)
+		result.Decision, result.Output = DecisionPlanned, outputPath
+		fmt.Printf("Concat list %s:\n%s", listFile, sb.String())
+		printPlan(inputDir, utils.VideoInfo{}, cfg, cmd)
+		return nil
+	}
+	tempPath, err := createTempOutput(outputPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempPath)
 
-	cmd := exec.Command(cfg.FfmpegPath, args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
+	cmd := buildMergeCommand(listFile, tempPath, ext, cfg, plan)
+	result.Command, result.Encoder = cmd.ShellString(), videoEncoder(cmd)
+	if err := runFFmpeg(ctx, cmd, cfg, verbose); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		return fmt.Errorf("failed to merge videos: %v", err)
 	}
+	info, err := verifyOutput(ctx, tempPath, expected)
+	if err != nil {
+		return err
+	}
+	result.OutputInfo = &info
+	if oldestSource != "" {
+		copyFileAttrs(oldestSource, tempPath, cfg)
+	}
+	replaced, err := commitOutput(tempPath, outputPath, cfg.Overwrite)
+	if err != nil {
+		return err
+	}
+	if !replaced {
+		fmt.Printf("Existing output %s is smaller, keeping it\n", outputPath)
+		result.Decision, result.Reason = DecisionKeptExisting, "existing output is smaller"
+		return nil
+	}
+	result.Decision, result.Output = DecisionEncoded, outputPath
+	if fi, err := os.Stat(outputPath); err == nil {
+		result.OutputSize = fi.Size()
+	}
 
 	fmt.Printf("Merge complete, output: %s\n", outputPath)
 	return nil
 }
+
+// printPlan prints the target settings and the shell-quoted command of a dry run
+func printPlan(input string, source utils.VideoInfo, cfg config.VideoConfig, cmd *ffmpeg.Command) {
+	fmt.Printf("Plan for %s:\n", input)
+	if source.Width > 0 {
+		w, h := source.DisplayDimensions()
+		fmt.Printf("  Source: %dx%d %s, %.2fs\n", w, h, source.Codec, source.Duration)
+	}
+	fmt.Printf("  Target: %dx%d, %dk, encoder %s\n", cfg.Width, cfg.Height, cfg.Bitrate, videoEncoder(cmd))
+	fmt.Printf("  Command: %s\n", cmd.ShellString())
+}
+
+// videoEncoder returns the video encoder selected by cmd ("" if none is set)
+func videoEncoder(cmd *ffmpeg.Command) string {
+	for _, out := range cmd.Outputs {
+		for i := 0; i+1 < len(out.Codecs); i++ {
+			if out.Codecs[i] == "-c:v" {
+				return out.Codecs[i+1]
+			}
+		}
+	}
+	return ""
+}
+
+// earlierTimestamp reports whether the creation_time a is before b.
+// Unparsable timestamps are never considered earlier.
+func earlierTimestamp(a, b string) bool {
+	ta, err := time.Parse(time.RFC3339Nano, a)
+	if err != nil {
+		return false
+	}
+	tb, err := time.Parse(time.RFC3339Nano, b)
+	if err != nil {
+		return true
+	}
+	return ta.Before(tb)
+}
@@ -0,0 +1,237 @@
+package video
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"video_compressor/src/config"
+	"video_compressor/src/ffmpeg"
+	"video_compressor/src/utils"
+)
+
+// testConfig returns a configuration with fixed dimensions so that no probing is needed
+func testConfig(encoder string) config.VideoConfig {
+	return config.VideoConfig{
+		FfmpegPath: "ffmpeg",
+		Fps:        config.FrameRate{Mode: config.FrameRateSource},
+		Bitrate:    5000,
+		Preset:     "medium",
+		Cq:         28,
+		Width:      1920,
+		Height:     1080,
+		Encoder:    encoder,
+	}
+}
+
+var (
+	nvencArgs = []string{"-c:v", "hevc_nvenc", "-rc", "vbr", "-cq", "28", "-b:v", "5000k", "-maxrate", "5000k", "-bufsize", "10000k"}
+	x264Args  = []string{"-c:v", "libx264", "-preset", "medium", "-crf", "28", "-b:v", "5000k", "-maxrate", "5000k", "-bufsize", "10000k"}
+	x265Args  = []string{"-c:v", "libx265", "-preset", "medium", "-crf", "28", "-b:v", "5000k", "-maxrate", "5000k", "-bufsize", "10000k"}
+	vp9Args   = []string{"-c:v", "libvpx-vp9", "-crf", "28", "-b:v", "5000k"}
+	wmv2Args  = []string{"-c:v", "wmv2", "-b:v", "5000k"}
+)
+
+func TestBuildCompressCommandContainers(t *testing.T) {
+	tests := []struct {
+		ext     string
+		encoder string
+		codec   []string
+		muxer   string
+	}{
+		{".mp4", "gpu", nvencArgs, "mp4"},
+		{".mov", "gpu", nvencArgs, "mov"},
+		{".mkv", "gpu", nvencArgs, "matroska"},
+		{".ts", "gpu", nvencArgs, "mpegts"},
+		// Containers without hevc_nvenc support fall back to the CPU encoder
+		{".avi", "gpu", x264Args, "avi"},
+		{".flv", "gpu", x264Args, "flv"},
+		{".webm", "gpu", vp9Args, "webm"},
+		{".wmv", "gpu", wmv2Args, "asf"},
+		{".mp4", "cpu", x264Args, "mp4"},
+		{".mov", "cpu", x264Args, "mov"},
+		{".mkv", "cpu", x265Args, "matroska"},
+		{".ts", "cpu", x264Args, "mpegts"},
+		{".avi", "cpu", x264Args, "avi"},
+		{".flv", "cpu", x264Args, "flv"},
+		{".webm", "cpu", vp9Args, "webm"},
+		{".wmv", "cpu", wmv2Args, "asf"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.encoder+tt.ext, func(t *testing.T) {
+			cmd := buildCompressCommand("in.mov", "out"+tt.ext, tt.ext, testConfig(tt.encoder), compressPlan{})
+
+			want := []string{"-y", "-i", "in.mov"}
+			want = append(want, tt.codec...)
+			want = append(want, "-vf", "scale=1920:1080", "-f", tt.muxer, "out"+tt.ext)
+			if got := cmd.Args(); !reflect.DeepEqual(got, want) {
+				t.Errorf("Args() =\n%q\nwant\n%q", got, want)
+			}
+		})
+	}
+}
+
+func TestBuildCompressCommandFilters(t *testing.T) {
+	cfg := testConfig("cpu")
+	cfg.Fps = config.FrameRate{Mode: config.FrameRateFixed, Num: 30000, Den: 1001}
+	cfg.Denoise = "light"
+	cfg.DenoiseFilter = "hqdn3d"
+	cfg.DeinterlaceFilter = "yadif"
+	cfg.ToneMapOperator = "mobius"
+	plan := compressPlan{
+		crop:        &utils.CropRect{Width: 1920, Height: 800, X: 0, Y: 140},
+		deinterlace: true,
+		toneMap:     true,
+	}
+
+	want := []string{"-y", "-i", "in.mkv"}
+	want = append(want, x264Args...)
+	want = append(want,
+		"-vf", "yadif=mode=send_frame:parity=auto:deint=all,"+
+			"crop=1920:800:0:140,"+
+			"hqdn3d=2:1.5:3:2.25,"+
+			"zscale=t=linear:npl=100,format=gbrpf32le,zscale=p=bt709,"+
+			"tonemap=tonemap=mobius:desat=0,zscale=t=bt709:m=bt709:r=tv,format=yuv420p,"+
+			"scale=1920:1080",
+		"-color_primaries", "bt709", "-color_trc", "bt709", "-colorspace", "bt709",
+		"-r", "30000/1001",
+		"-f", "mp4", "out.mp4",
+	)
+	if got := buildCompressCommand("in.mkv", "out.mp4", ".mp4", cfg, plan).Args(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Args() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestBuildCompressCommandPreserveHDR(t *testing.T) {
+	tests := []struct {
+		ext     string
+		encoder string
+		codec   []string
+	}{
+		{".mkv", "gpu", []string{
+			"-c:v", "hevc_nvenc", "-profile:v", "main10", "-pix_fmt", "p010le",
+			"-rc", "vbr", "-cq", "28", "-b:v", "5000k", "-maxrate", "5000k", "-bufsize", "10000k",
+		}},
+		{".mp4", "cpu", []string{
+			"-c:v", "libx265", "-preset", "medium", "-pix_fmt", "yuv420p10le",
+			"-crf", "28", "-b:v", "5000k", "-maxrate", "5000k", "-bufsize", "10000k",
+			"-x265-params", "hdr-opt=1:repeat-headers=1:colorprim=bt2020:transfer=smpte2084:colormatrix=bt2020nc",
+			"-tag:v", "hvc1",
+		}},
+		{".webm", "gpu", []string{
+			"-c:v", "libsvtav1", "-pix_fmt", "yuv420p10le", "-crf", "28", "-b:v", "5000k",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.encoder+tt.ext, func(t *testing.T) {
+			plan := compressPlan{preserveHDR: true, transfer: "smpte2084"}
+			cmd := buildCompressCommand("in.mov", "out"+tt.ext, tt.ext, testConfig(tt.encoder), plan)
+
+			want := []string{"-y", "-i", "in.mov"}
+			want = append(want, tt.codec...)
+			want = append(want, "-color_primaries", "bt2020", "-color_trc", "smpte2084", "-colorspace", "bt2020nc")
+			want = append(want, "-vf", "scale=1920:1080", "-f", ffmpeg.MuxerName(tt.ext), "out"+tt.ext)
+			if got := cmd.Args(); !reflect.DeepEqual(got, want) {
+				t.Errorf("Args() =\n%q\nwant\n%q", got, want)
+			}
+		})
+	}
+}
+
+func TestBuildCompressCommandMetadata(t *testing.T) {
+	cfg := testConfig("cpu")
+	cfg.PreserveMetadata = true
+
+	want := []string{"-y", "-i", "in.mov"}
+	want = append(want, x264Args...)
+	want = append(want,
+		"-vf", "scale=1920:1080",
+		"-map_metadata", "0", "-movflags", "use_metadata_tags", "-metadata:s:v:0", "rotate=0",
+		"-f", "mp4", "out.mp4",
+	)
+	if got := buildCompressCommand("in.mov", "out.mp4", ".mp4", cfg, compressPlan{rotated: true}).Args(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Args() =\n%q\nwant\n%q", got, want)
+	}
+
+	want = []string{"-y", "-f", "concat", "-safe", "0", "-i", "files.txt"}
+	want = append(want, x265Args...)
+	want = append(want,
+		"-vf", "scale=1920:1080:force_original_aspect_ratio=decrease,pad=1920:1080:(ow-iw)/2:(oh-ih)/2,setsar=1",
+		"-metadata", "creation_time=2024-05-01T12:00:00.000000Z",
+		"-f", "matroska", "merged.mkv",
+	)
+	plan := mergePlan{creationTime: "2024-05-01T12:00:00.000000Z"}
+	if got := buildMergeCommand("files.txt", "merged.mkv", ".mkv", cfg, plan).Args(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Args() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestBuildCompressCommandOverlays(t *testing.T) {
+	cfg := testConfig("cpu")
+	cfg.Watermark = "logo.png"
+	cfg.WatermarkPosition = config.PositionBottomRight
+	cfg.WatermarkMargin = 20
+	cfg.WatermarkScale = 0.15
+	cfg.WatermarkOpacity = 0.5
+	cfg.TextPosition = config.PositionTopLeft
+	cfg.TextSize = 24
+	plan := compressPlan{
+		streams: streamSelection{video: "0:0", maps: []string{"0:0", "0:1"}},
+		overlay: overlayPlan{
+			text:  overlayText("{filename} {timecode}", "50%.mp4", time.Time{}),
+			width: 1920,
+		},
+	}
+
+	want := []string{"-y", "-i", "in.mov", "-i", "logo.png",
+		"-filter_complex", "[0:0]scale=1920:1080[base];" +
+			"[1:v]scale=288:-1,format=rgba,colorchannelmixer=aa=0.5[wm];" +
+			"[base][wm]overlay=x=W-w-20:y=H-h-20," +
+			`drawtext=text=50\\\\%.mp4 %{pts\\:hms}:fontsize=24:fontcolor=white:box=1:boxcolor=black@0.5:boxborderw=8:x=20:y=20[vout]`,
+		"-map", "[vout]", "-map", "0:1",
+	}
+	want = append(want, x264Args...)
+	want = append(want, "-f", "mp4", "out.mp4")
+	if got := buildCompressCommand("in.mov", "out.mp4", ".mp4", cfg, plan).Args(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Args() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestBuildMergeCommand(t *testing.T) {
+	want := []string{"-y", "-f", "concat", "-safe", "0", "-i", "files.txt"}
+	want = append(want, x265Args...)
+	want = append(want,
+		"-vf", "scale=1920:1080:force_original_aspect_ratio=decrease,pad=1920:1080:(ow-iw)/2:(oh-ih)/2,setsar=1",
+		"-f", "matroska", "merged.mkv",
+	)
+	if got := buildMergeCommand("files.txt", "merged.mkv", ".mkv", testConfig("cpu"), mergePlan{}).Args(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Args() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestRunFFmpegUsesRunner(t *testing.T) {
+	fake := &ffmpeg.FakeRunner{
+		Handler: func(inv ffmpeg.Invocation, stdout, stderr io.Writer) error {
+			io.WriteString(stderr, "Input #0, mov\nUnknown encoder 'libfoo'\n\n")
+			return errors.New("exit status 1")
+		},
+	}
+	defer func(r ffmpeg.Runner) { ffmpeg.DefaultRunner = r }(ffmpeg.DefaultRunner)
+	ffmpeg.DefaultRunner = fake
+
+	cmd := buildCompressCommand("in.mp4", "out.mp4", ".mp4", testConfig("cpu"), compressPlan{})
+	err := runFFmpeg(context.Background(), cmd, testConfig("cpu"), false)
+	if want := "ffmpeg execution error: exit status 1: Unknown encoder 'libfoo'"; err == nil || err.Error() != want {
+		t.Fatalf("runFFmpeg() error = %v, want %q", err, want)
+	}
+
+	calls := fake.Calls()
+	if len(calls) != 1 || calls[0].Binary != "ffmpeg" || !reflect.DeepEqual(calls[0].Args, cmd.Args()) {
+		t.Errorf("Calls() = %q, want one invocation of %q", calls, cmd.Args())
+	}
+}
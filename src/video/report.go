@@ -0,0 +1,27 @@
+package video
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// reportRecord is a Result as written to a report
+type reportRecord struct {
+	*Result
+	ReductionPercent float64 `json:"reduction_percent"`
+}
+
+// WriteReport writes results as JSON: an indented object for a single result, or
+// JSON Lines (one object per line) if lines is set
+func WriteReport(w io.Writer, results []*Result, lines bool) error {
+	enc := json.NewEncoder(w)
+	if !lines {
+		enc.SetIndent("", "  ")
+	}
+	for _, r := range results {
+		if err := enc.Encode(reportRecord{r, r.Reduction()}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
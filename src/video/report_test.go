@@ -0,0 +1,52 @@
+package video
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"video_compressor/src/utils"
+)
+
+func TestWriteReport(t *testing.T) {
+	results := []*Result{
+		{
+			Input: "a.mov", Output: "out/a.mp4", Decision: DecisionEncoded,
+			InputSize: 1000, OutputSize: 250, Encoder: "libx264",
+			Source: &utils.VideoInfo{Width: 1920, Height: 1080, Codec: "h264"},
+		},
+		{Input: "b.mov", Decision: DecisionFailed, Reason: "invalid video file: b.mov"},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteReport(&buf, results, true); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2:\n%s", len(lines), buf.String())
+	}
+
+	var first map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatal(err)
+	}
+	if first["reduction_percent"] != 75.0 || first["encoder"] != "libx264" || first["output"] != "out/a.mp4" {
+		t.Errorf("first record = %v", first)
+	}
+	if source, _ := first["source"].(map[string]any); source["codec"] != "h264" {
+		t.Errorf("source = %v, want codec h264", first["source"])
+	}
+
+	var second map[string]any
+	if err := json.Unmarshal([]byte(lines[1]), &second); err != nil {
+		t.Fatal(err)
+	}
+	if second["decision"] != "failed" || second["reason"] != "invalid video file: b.mov" {
+		t.Errorf("second record = %v", second)
+	}
+	if _, ok := second["output"]; ok {
+		t.Errorf("second record has an output: %v", second)
+	}
+}
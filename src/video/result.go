@@ -0,0 +1,39 @@
+package video
+
+import "video_compressor/src/utils"
+
+// Decision records what happened to an input
+type Decision string
+
+const (
+	DecisionEncoded      Decision = "encoded"       // The output was encoded and written
+	DecisionSkipped      Decision = "skipped"       // The input was not re-encoded
+	DecisionDiscarded    Decision = "discarded"     // The output was encoded but did not save enough
+	DecisionKeptExisting Decision = "kept-existing" // An existing smaller output was kept
+	DecisionFailed       Decision = "failed"        // Processing failed
+	DecisionPlanned      Decision = "planned"       // Dry run: the output would be encoded
+)
+
+// Result describes the outcome of processing a single input
+type Result struct {
+	Input      string           `json:"input"`
+	Output     string           `json:"output,omitempty"` // Path that was written, empty if nothing was written
+	Decision   Decision         `json:"decision"`
+	Reason     string           `json:"reason,omitempty"` // Why the input was skipped, discarded or failed
+	InputSize  int64            `json:"input_size"`
+	OutputSize int64            `json:"output_size"`
+	Source     *utils.VideoInfo `json:"source,omitempty"`      // Probed input, nil if probing failed
+	OutputInfo *utils.VideoInfo `json:"output_info,omitempty"` // Probed output, nil if nothing was encoded
+	Command    string           `json:"command,omitempty"`     // FFmpeg command that encoded the output
+	Encoder    string           `json:"encoder,omitempty"`     // Video encoder used, e.g. hevc_nvenc or libx264
+	WallTime   float64          `json:"wall_time"`             // Processing time in seconds, including analysis
+	Speed      float64          `json:"speed,omitempty"`       // Encoded media seconds per second of encoding
+}
+
+// Reduction returns the size reduction in percent (0 if nothing was written)
+func (r *Result) Reduction() float64 {
+	if r.InputSize == 0 || r.Output == "" {
+		return 0
+	}
+	return (1 - float64(r.OutputSize)/float64(r.InputSize)) * 100
+}
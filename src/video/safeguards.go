@@ -0,0 +1,90 @@
+package video
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"video_compressor/src/config"
+	"video_compressor/src/utils"
+)
+
+// skipReason returns why the input should not be re-encoded, or "" to encode it.
+// codec is the resolved output codec (e.g. "hevc") and cfg must already hold the target
+// dimensions.
+func skipReason(source utils.VideoInfo, codec string, cfg config.VideoConfig) string {
+	if cfg.SkipBelowBpp > 0 {
+		if bpp := source.BitsPerPixel(); bpp > 0 && bpp < cfg.SkipBelowBpp {
+			return fmt.Sprintf("already efficient: %.3f bits per pixel is below %.3f", bpp, cfg.SkipBelowBpp)
+		}
+	}
+
+	if cfg.SkipTargetCodec && source.Codec != "" && source.Codec == codec {
+		width, height := source.DisplayDimensions()
+		underTarget := cfg.Width == 0 || cfg.Height == 0 ||
+			(width <= cfg.Width && height <= cfg.Height)
+		if underTarget {
+			return fmt.Sprintf("already %s at or under the target resolution", source.Codec)
+		}
+	}
+	return ""
+}
+
+// savingTooSmall reports whether an output does not save at least cfg.MinSavingPercent
+func savingTooSmall(origSize, newSize int64, cfg config.VideoConfig) bool {
+	if origSize == 0 || cfg.KeepAllOutputs {
+		return false
+	}
+	saving := (1 - float64(newSize)/float64(origSize)) * 100
+	return saving < cfg.MinSavingPercent
+}
+
+// keepOriginal applies cfg.SkipAction for an input that is not re-encoded.
+// With SkipCopyOriginal the original is copied next to the output path, keeping its own
+// extension; the path written is returned ("" if nothing was written).
+func keepOriginal(inputPath, outputPath, ext string, cfg config.VideoConfig) (string, error) {
+	if cfg.SkipAction != config.SkipCopyOriginal {
+		return "", nil
+	}
+
+	copyPath := strings.TrimSuffix(outputPath, ext) + filepath.Ext(inputPath)
+	if err := checkOverwrite(copyPath, cfg.Overwrite); err != nil {
+		return "", err
+	}
+	tempPath, err := createTempOutput(copyPath)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tempPath)
+
+	if err := copyFile(inputPath, tempPath); err != nil {
+		return "", fmt.Errorf("failed to copy original: %v", err)
+	}
+	copyFileAttrs(inputPath, tempPath, cfg)
+	replaced, err := commitOutput(tempPath, copyPath, cfg.Overwrite)
+	if err != nil || !replaced {
+		return "", err
+	}
+	return copyPath, nil
+}
+
+// copyFile copies the contents of src to dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,50 @@
+package video
+
+import (
+	"testing"
+
+	"video_compressor/src/config"
+	"video_compressor/src/utils"
+)
+
+func TestSkipReason(t *testing.T) {
+	source := utils.VideoInfo{Codec: "hevc", Width: 1920, Height: 1080, FrameRate: 30, BitRate: 2_000_000}
+	cfg := config.VideoConfig{SkipTargetCodec: true, Width: 1920, Height: 1080}
+	tests := []struct {
+		name  string
+		codec string
+		cfg   func(*config.VideoConfig)
+		skip  bool
+	}{
+		{"same codec", "hevc", nil, true},
+		{"other codec", "h264", nil, false},
+		{"above target", "hevc", func(c *config.VideoConfig) { c.Width, c.Height = 1280, 720 }, false},
+		{"disabled", "hevc", func(c *config.VideoConfig) { c.SkipTargetCodec = false }, false},
+		{"low bpp", "h264", func(c *config.VideoConfig) { c.SkipBelowBpp = 0.05 }, true},
+	}
+	for _, tt := range tests {
+		c := cfg
+		if tt.cfg != nil {
+			tt.cfg(&c)
+		}
+		if got := skipReason(source, tt.codec, c); (got != "") != tt.skip {
+			t.Errorf("%s: skipReason() = %q, want skip %v", tt.name, got, tt.skip)
+		}
+	}
+}
+
+func TestSavingTooSmall(t *testing.T) {
+	cfg := config.VideoConfig{MinSavingPercent: 10}
+	if !savingTooSmall(100, 95, cfg) || savingTooSmall(100, 80, cfg) {
+		t.Error("savingTooSmall() does not apply MinSavingPercent")
+	}
+	// A larger output is discarded by default, but kept for merge segments
+	cfg = config.VideoConfig{}
+	if !savingTooSmall(100, 120, cfg) {
+		t.Error("savingTooSmall() keeps a larger output")
+	}
+	cfg.KeepAllOutputs = true
+	if savingTooSmall(100, 120, cfg) {
+		t.Error("savingTooSmall() discards an output with KeepAllOutputs")
+	}
+}
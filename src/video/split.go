@@ -0,0 +1,134 @@
+package video
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"video_compressor/src/config"
+	"video_compressor/src/ffmpeg"
+	"video_compressor/src/utils"
+)
+
+// SplitVideo cuts the input into segments of about segmentSeconds each without
+// re-encoding and returns the written files in order. Cuts happen at keyframes,
+// so segments can be slightly longer than requested.
+func SplitVideo(ctx context.Context, inputPath, outputDir string, segmentSeconds float64, cfg config.VideoConfig) ([]string, error) {
+	if segmentSeconds <= 0 {
+		return nil, fmt.Errorf("segment duration must be positive")
+	}
+	return splitVideo(ctx, inputPath, outputDir, []string{"-segment_time", formatSeconds(segmentSeconds)}, cfg)
+}
+
+// SplitVideoParts cuts the input into parts segments of equal length without
+// re-encoding and returns the written files in order. Cuts happen at the first
+// keyframe after each cut point, so there are fewer parts only if the input has
+// fewer keyframes.
+func SplitVideoParts(ctx context.Context, inputPath, outputDir string, parts int, cfg config.VideoConfig) ([]string, error) {
+	if parts < 1 {
+		return nil, fmt.Errorf("the number of parts must be positive")
+	}
+	total, err := utils.GetVideoDuration(ctx, inputPath)
+	if err != nil {
+		return nil, err
+	}
+	return splitVideo(ctx, inputPath, outputDir, partCuts(total, parts), cfg)
+}
+
+// partCuts returns the segment muxer options cutting total seconds into parts of equal
+// length. Explicit cut points cannot produce an extra segment from rounding at the end.
+func partCuts(total float64, parts int) []string {
+	if parts == 1 {
+		// No cut before the end (the muxer's default segment time is 2 seconds)
+		return []string{"-segment_time", formatSeconds(total + 1)}
+	}
+	var times []string
+	for i := 1; i < parts; i++ {
+		times = append(times, formatSeconds(total*float64(i)/float64(parts)))
+	}
+	return []string{"-segment_times", strings.Join(times, ",")}
+}
+
+// splitVideo cuts the input into segments at the cut points given by the segment muxer
+// options in cuts
+func splitVideo(ctx context.Context, inputPath, outputDir string, cuts []string, cfg config.VideoConfig) ([]string, error) {
+	if !utils.IsVideoFileValid(ctx, inputPath) {
+		return nil, fmt.Errorf("invalid video file: %s", inputPath)
+	}
+	if !ffmpeg.IsSupportedFormat(inputPath) {
+		return nil, fmt.Errorf("unsupported input format; supported: %v", ffmpeg.SupportedFormatsKeys())
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %v", err)
+	}
+
+	// Segments are written to a hidden directory and only moved into place when complete
+	tempDir, err := os.MkdirTemp(outputDir, ".split_*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Stream copy keeps the codecs, so the segments use the container of the input
+	ext := strings.ToLower(filepath.Ext(inputPath))
+	name := strings.TrimSuffix(filepath.Base(inputPath), filepath.Ext(inputPath))
+	cmd := buildSplitCommand(inputPath, filepath.Join(tempDir, name+"_%03d"+ext), ext, cuts, cfg)
+	if err := runFFmpeg(ctx, cmd, cfg, true); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(tempDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read segments: %v", err)
+	}
+	var segments []string
+	for _, e := range entries {
+		segments = append(segments, e.Name())
+	}
+	sort.Strings(segments)
+
+	var written []string
+	for _, segment := range segments {
+		outputPath := filepath.Join(outputDir, segment)
+		if err := checkOverwrite(outputPath, cfg.Overwrite); err != nil {
+			return written, err
+		}
+		tempPath := filepath.Join(tempDir, segment)
+		copyFileAttrs(inputPath, tempPath, cfg)
+		replaced, err := commitOutput(tempPath, outputPath, cfg.Overwrite)
+		if err != nil {
+			return written, err
+		}
+		if replaced {
+			written = append(written, outputPath)
+		}
+	}
+	return written, nil
+}
+
+// buildSplitCommand builds the FFmpeg command that copies all streams of inputPath into
+// segments named after the printf-style pattern, cut according to the segment muxer
+// options in cuts (-segment_time or -segment_times)
+func buildSplitCommand(inputPath, pattern, ext string, cuts []string, cfg config.VideoConfig) *ffmpeg.Command {
+	cmd := ffmpeg.NewCommand(cfg.FfmpegPath, "-y").AddInput(inputPath)
+	out := cmd.AddOutput(pattern).Map("0").Codec("-c", "copy")
+	out.Option(cuts...)
+	out.Option("-reset_timestamps", "1")
+	if muxer := ffmpeg.MuxerName(ext); muxer != "" {
+		out.Option("-segment_format", muxer)
+	}
+	if cfg.PreserveMetadata {
+		out.Option("-map_metadata", "0")
+	}
+	out.Format = "segment"
+	return cmd
+}
+
+// formatSeconds formats a time in seconds with millisecond precision
+func formatSeconds(s float64) string {
+	return strconv.FormatFloat(s, 'f', 3, 64)
+}
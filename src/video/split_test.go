@@ -0,0 +1,37 @@
+package video
+
+import (
+	"reflect"
+	"testing"
+
+	"video_compressor/src/config"
+)
+
+func TestPartCuts(t *testing.T) {
+	tests := []struct {
+		total float64
+		parts int
+		want  []string
+	}{
+		// A short input still gets the requested number of parts
+		{5, 4, []string{"-segment_times", "1.250,2.500,3.750"}},
+		{10, 3, []string{"-segment_times", "3.333,6.667"}},
+		{3600, 2, []string{"-segment_times", "1800.000"}},
+		{5, 1, []string{"-segment_time", "6.000"}},
+	}
+	for _, tt := range tests {
+		if got := partCuts(tt.total, tt.parts); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("partCuts(%v, %d) = %q, want %q", tt.total, tt.parts, got, tt.want)
+		}
+	}
+}
+
+func TestBuildSplitCommand(t *testing.T) {
+	cmd := buildSplitCommand("in.mp4", "out/in_%03d.mp4", ".mp4", partCuts(5, 4), config.VideoConfig{FfmpegPath: "ffmpeg"})
+	want := []string{"-y", "-i", "in.mp4", "-map", "0", "-c", "copy",
+		"-segment_times", "1.250,2.500,3.750", "-reset_timestamps", "1", "-segment_format", "mp4",
+		"-f", "segment", "out/in_%03d.mp4"}
+	if got := cmd.Args(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Args() =\n%q\nwant\n%q", got, want)
+	}
+}
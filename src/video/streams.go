@@ -0,0 +1,148 @@
+package video
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+
+	"video_compressor/src/config"
+	"video_compressor/src/utils"
+)
+
+// textSubtitleCodecs are the subtitle codecs that can be converted into another text format
+var textSubtitleCodecs = map[string]bool{
+	"subrip":   true,
+	"srt":      true,
+	"ass":      true,
+	"ssa":      true,
+	"mov_text": true,
+	"webvtt":   true,
+	"text":     true,
+}
+
+// streamSelection holds the extra inputs, -map specifiers and per-stream args of an output
+type streamSelection struct {
+	inputs  []string // Inputs added after the source, e.g. sidecar subtitles
+	video   string   // Map specifier of the video stream ("" if none)
+	maps    []string
+	args    []string           // Per-stream codec and metadata args
+	streams []utils.StreamInfo // Streams kept in the output
+}
+
+// selectStreams chooses the source streams to keep: the first video stream, the audio
+// streams selected by cfg.Audio, subtitles the container can store and, for MKV,
+// attachments such as fonts. Data streams are dropped since some muxers reject them.
+// Sidecar subtitles are added as extra inputs after the embedded subtitles. The embedded
+// subtitle track burned into the picture (starting at 1, 0 for none) is left out.
+func selectStreams(source utils.VideoInfo, ext string, cfg config.VideoConfig, sidecars []sidecarSubtitle, burned int) streamSelection {
+	var sel streamSelection
+	add := func(s utils.StreamInfo) {
+		sel.maps = append(sel.maps, "0:"+strconv.Itoa(s.Index))
+		sel.streams = append(sel.streams, s)
+	}
+
+	var audio, subtitles, attachments []utils.StreamInfo
+	for _, s := range source.Streams {
+		switch s.Type {
+		case "video":
+			if sel.video == "" {
+				add(s)
+				sel.video = sel.maps[len(sel.maps)-1]
+			}
+		case "audio":
+			audio = append(audio, s)
+		case "subtitle":
+			subtitles = append(subtitles, s)
+		case "attachment":
+			attachments = append(attachments, s)
+		}
+	}
+
+	// Audio streams are encoded with the container's default audio encoder
+	switch cfg.Audio {
+	case config.AudioFirst:
+		audio = audio[:min(len(audio), 1)]
+	case config.AudioLanguage:
+		var matched []utils.StreamInfo
+		for _, s := range audio {
+			if slices.Contains(cfg.AudioLanguages, s.Language) {
+				matched = append(matched, s)
+			}
+		}
+		if len(matched) == 0 && len(audio) > 0 {
+			fmt.Printf("Warning: no audio stream in %v, keeping the first audio stream\n", cfg.AudioLanguages)
+			matched = audio[:1]
+		}
+		audio = matched
+	}
+	for _, s := range audio {
+		add(s)
+	}
+
+	n := 0 // Output subtitle stream index
+	if cfg.Subtitles == config.SubtitlesCopy {
+		for i, s := range subtitles {
+			// A burned track is not kept as a subtitle stream as well
+			if i == burned-1 {
+				continue
+			}
+			codec := subtitleCodec(s.Codec, ext)
+			if codec == "" {
+				fmt.Printf("Warning: dropping %s subtitle stream %d, %s cannot store it\n", s.Codec, s.Index, ext)
+				continue
+			}
+			add(s)
+			sel.args = append(sel.args, fmt.Sprintf("-c:s:%d", n), codec)
+			n++
+		}
+	}
+	for _, sc := range sidecars {
+		codec := subtitleCodec(sc.codec, ext)
+		if codec == "" {
+			fmt.Printf("Warning: skipping subtitle file %s, %s cannot store it\n", sc.path, ext)
+			continue
+		}
+		sel.inputs = append(sel.inputs, sc.path)
+		sel.maps = append(sel.maps, fmt.Sprintf("%d:0", len(sel.inputs)))
+		sel.streams = append(sel.streams, utils.StreamInfo{Type: "subtitle", Codec: sc.codec, Language: sc.language})
+		sel.args = append(sel.args,
+			fmt.Sprintf("-c:s:%d", n), codec,
+			fmt.Sprintf("-metadata:s:s:%d", n), "language="+sc.language,
+		)
+		n++
+	}
+
+	if ext == ".mkv" && len(attachments) > 0 {
+		for _, s := range attachments {
+			add(s)
+		}
+		sel.args = append(sel.args, "-c:t", "copy")
+	}
+	return sel
+}
+
+// subtitleCodec returns the codec for a subtitle stream in the given container:
+// "copy", a text format to convert to, or "" if the container cannot store it
+func subtitleCodec(codec, ext string) string {
+	switch ext {
+	case ".mkv":
+		// Matroska stores text and bitmap subtitles, but not MP4's mov_text
+		if codec == "mov_text" {
+			return "srt"
+		}
+		return "copy"
+	case ".mp4", ".mov":
+		if textSubtitleCodecs[codec] {
+			return "mov_text"
+		}
+	case ".webm":
+		if textSubtitleCodecs[codec] {
+			return "webvtt"
+		}
+	case ".ts":
+		if codec == "dvb_subtitle" {
+			return "copy"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,88 @@
+package video
+
+import (
+	"reflect"
+	"testing"
+
+	"video_compressor/src/config"
+	"video_compressor/src/utils"
+)
+
+func TestSelectStreams(t *testing.T) {
+	source := utils.VideoInfo{Streams: []utils.StreamInfo{
+		{Index: 0, Type: "video", Codec: "h264"},
+		{Index: 1, Type: "audio", Codec: "aac", Language: "jpn"},
+		{Index: 2, Type: "audio", Codec: "ac3", Language: "eng"},
+		{Index: 3, Type: "subtitle", Codec: "ass", Language: "eng"},
+		{Index: 4, Type: "subtitle", Codec: "hdmv_pgs_subtitle", Language: "eng"},
+		{Index: 5, Type: "attachment", Codec: "ttf"},
+		{Index: 6, Type: "data", Codec: "bin_data"},
+	}}
+
+	tests := []struct {
+		name  string
+		ext   string
+		audio config.AudioSelection
+		subs  config.SubtitleMode
+		maps  []string
+		args  []string
+	}{
+		{"mkv keeps everything but data", ".mkv", config.AudioAll, config.SubtitlesCopy,
+			[]string{"0:0", "0:1", "0:2", "0:3", "0:4", "0:5"},
+			[]string{"-c:s:0", "copy", "-c:s:1", "copy", "-c:t", "copy"}},
+		{"mp4 converts text subtitles", ".mp4", config.AudioFirst, config.SubtitlesCopy,
+			[]string{"0:0", "0:1", "0:3"},
+			[]string{"-c:s:0", "mov_text"}},
+		{"webm by language", ".webm", config.AudioLanguage, config.SubtitlesCopy,
+			[]string{"0:0", "0:2", "0:3"},
+			[]string{"-c:s:0", "webvtt"}},
+		{"drop subtitles", ".mkv", config.AudioFirst, config.SubtitlesDrop,
+			[]string{"0:0", "0:1", "0:5"},
+			[]string{"-c:t", "copy"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig("cpu")
+			cfg.Audio, cfg.AudioLanguages, cfg.Subtitles = tt.audio, []string{"eng"}, tt.subs
+			sel := selectStreams(source, tt.ext, cfg, nil, 0)
+			if !reflect.DeepEqual(sel.maps, tt.maps) {
+				t.Errorf("maps = %q, want %q", sel.maps, tt.maps)
+			}
+			if !reflect.DeepEqual(sel.args, tt.args) {
+				t.Errorf("args = %q, want %q", sel.args, tt.args)
+			}
+		})
+	}
+}
+
+func TestSelectStreamsSidecars(t *testing.T) {
+	source := utils.VideoInfo{Streams: []utils.StreamInfo{
+		{Index: 0, Type: "video", Codec: "h264"},
+		{Index: 1, Type: "subtitle", Codec: "subrip"},
+		{Index: 2, Type: "subtitle", Codec: "ass"},
+	}}
+	sidecars := []sidecarSubtitle{
+		{path: "talk.en.srt", codec: "subrip", language: "eng"},
+		{path: "talk.ja.ass", codec: "ass", language: "jpn"},
+	}
+	cfg := testConfig("cpu")
+	cfg.Subtitles = config.SubtitlesCopy
+
+	// Track 1 is burned, so not kept as a subtitle stream
+	sel := selectStreams(source, ".mp4", cfg, sidecars, 1)
+	if want := []string{"talk.en.srt", "talk.ja.ass"}; !reflect.DeepEqual(sel.inputs, want) {
+		t.Errorf("inputs = %q, want %q", sel.inputs, want)
+	}
+	if want := []string{"0:0", "0:2", "1:0", "2:0"}; !reflect.DeepEqual(sel.maps, want) {
+		t.Errorf("maps = %q, want %q", sel.maps, want)
+	}
+	want := []string{
+		"-c:s:0", "mov_text",
+		"-c:s:1", "mov_text", "-metadata:s:s:1", "language=eng",
+		"-c:s:2", "mov_text", "-metadata:s:s:2", "language=jpn",
+	}
+	if !reflect.DeepEqual(sel.args, want) {
+		t.Errorf("args = %q, want %q", sel.args, want)
+	}
+}
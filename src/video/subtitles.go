@@ -0,0 +1,124 @@
+package video
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"video_compressor/src/config"
+	"video_compressor/src/ffmpeg"
+	"video_compressor/src/filtergraph"
+	"video_compressor/src/utils"
+)
+
+// sidecarSubtitle is a subtitle file next to an input video
+type sidecarSubtitle struct {
+	path     string
+	codec    string // Codec name as reported by ffprobe
+	language string // ISO 639-2 code, "und" if unknown
+}
+
+// sidecarCodecs maps the supported sidecar file extensions to their codec names
+var sidecarCodecs = map[string]string{
+	".srt": "subrip",
+	".ass": "ass",
+	".ssa": "ass",
+	".vtt": "webvtt",
+}
+
+// iso639Codes maps common two-letter language codes to the ISO 639-2 codes used by MP4 and MKV
+var iso639Codes = map[string]string{
+	"ar": "ara",
+	"de": "ger",
+	"en": "eng",
+	"es": "spa",
+	"fr": "fre",
+	"hi": "hin",
+	"it": "ita",
+	"ja": "jpn",
+	"ko": "kor",
+	"nl": "dut",
+	"pl": "pol",
+	"pt": "por",
+	"ru": "rus",
+	"sv": "swe",
+	"tr": "tur",
+	"zh": "chi",
+}
+
+// findSidecarSubtitles returns the subtitle files named after the input with a language
+// suffix, e.g. lecture.en.srt and lecture.jpn.forced.ass for lecture.mp4
+func findSidecarSubtitles(inputPath string) []sidecarSubtitle {
+	dir := filepath.Dir(inputPath)
+	stem := strings.TrimSuffix(filepath.Base(inputPath), filepath.Ext(inputPath))
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var sidecars []sidecarSubtitle
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, stem+".") {
+			continue
+		}
+		rest := strings.TrimPrefix(name, stem+".")
+		ext := strings.ToLower(filepath.Ext(rest))
+		codec, ok := sidecarCodecs[ext]
+		if !ok || rest == ext {
+			continue
+		}
+		// The language is the first suffix, further suffixes such as "forced" are ignored
+		lang, _, _ := strings.Cut(strings.TrimSuffix(rest, filepath.Ext(rest)), ".")
+		sidecars = append(sidecars, sidecarSubtitle{
+			path:     filepath.Join(dir, name),
+			codec:    codec,
+			language: languageCode(lang),
+		})
+	}
+	return sidecars
+}
+
+// languageCode converts a language suffix to an ISO 639-2 code
+func languageCode(lang string) string {
+	lang = strings.ToLower(lang)
+	if code, ok := iso639Codes[lang]; ok {
+		return code
+	}
+	if len(lang) == 3 {
+		return lang
+	}
+	return "und"
+}
+
+// burnSubtitlesFilter returns the filter that burns the configured subtitles into the
+// picture, or nil if none are configured. A selected track that does not exist or cannot
+// be rendered is an error, so that it is neither burned nor silently dropped.
+func burnSubtitlesFilter(inputPath string, source utils.VideoInfo, cfg config.VideoConfig) (*filtergraph.Filter, error) {
+	if cfg.BurnSubtitles != "" {
+		f := ffmpeg.SubtitlesFilter(cfg.BurnSubtitles, -1, cfg.FontsDir)
+		return &f, nil
+	}
+	if cfg.BurnSubtitleTrack <= 0 {
+		return nil, nil
+	}
+
+	track := 0
+	for _, s := range source.Streams {
+		if s.Type != "subtitle" {
+			continue
+		}
+		if track++; track != cfg.BurnSubtitleTrack {
+			continue
+		}
+		// The subtitles filter only renders text subtitles
+		if !textSubtitleCodecs[s.Codec] {
+			return nil, fmt.Errorf("cannot burn %s subtitle track %d, only text subtitles are supported",
+				s.Codec, cfg.BurnSubtitleTrack)
+		}
+		f := ffmpeg.SubtitlesFilter(inputPath, cfg.BurnSubtitleTrack-1, cfg.FontsDir)
+		return &f, nil
+	}
+	return nil, fmt.Errorf("subtitle track %d not found", cfg.BurnSubtitleTrack)
+}
@@ -0,0 +1,87 @@
+package video
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"video_compressor/src/utils"
+)
+
+func TestFindSidecarSubtitles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"lecture.mp4",
+		"lecture.en.srt",
+		"lecture.JPN.forced.ass",
+		"lecture.xx.vtt",
+		"lecture.srt",    // No language suffix
+		"lecture.en.txt", // Not a subtitle format
+		"lecture2.en.srt",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "lecture.de.srt"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	got := findSidecarSubtitles(filepath.Join(dir, "lecture.mp4"))
+	want := []sidecarSubtitle{
+		{path: filepath.Join(dir, "lecture.JPN.forced.ass"), codec: "ass", language: "jpn"},
+		{path: filepath.Join(dir, "lecture.en.srt"), codec: "subrip", language: "eng"},
+		{path: filepath.Join(dir, "lecture.xx.vtt"), codec: "webvtt", language: "und"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findSidecarSubtitles() = %+v, want %+v", got, want)
+	}
+}
+
+func TestLanguageCode(t *testing.T) {
+	tests := map[string]string{"en": "eng", "PT": "por", "deu": "deu", "eng": "eng", "english": "und", "x": "und"}
+	for lang, want := range tests {
+		if got := languageCode(lang); got != want {
+			t.Errorf("languageCode(%q) = %q, want %q", lang, got, want)
+		}
+	}
+}
+
+func TestBurnSubtitlesFilter(t *testing.T) {
+	source := utils.VideoInfo{Streams: []utils.StreamInfo{
+		{Index: 0, Type: "video", Codec: "h264"},
+		{Index: 1, Type: "subtitle", Codec: "subrip"},
+		{Index: 2, Type: "subtitle", Codec: "hdmv_pgs_subtitle"},
+	}}
+	tests := []struct {
+		name    string
+		file    string
+		track   int
+		want    string
+		wantErr bool
+	}{
+		{"none", "", 0, "", false},
+		{"file", "talk.ass", 2, "ass=filename=talk.ass", false},
+		{"text track", "", 1, "subtitles=filename=in.mkv:si=0", false},
+		{"bitmap track", "", 2, "", true},
+		{"missing track", "", 3, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig("cpu")
+			cfg.BurnSubtitles, cfg.BurnSubtitleTrack = tt.file, tt.track
+			f, err := burnSubtitlesFilter("in.mkv", source, cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("burnSubtitlesFilter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			got := ""
+			if f != nil {
+				got = f.String()
+			}
+			if got != tt.want {
+				t.Errorf("burnSubtitlesFilter() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,318 @@
+package video
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"video_compressor/src/config"
+	"video_compressor/src/ffmpeg"
+	"video_compressor/src/jobs"
+	"video_compressor/src/metrics"
+)
+
+// Folders created in each watched directory for processed originals
+const (
+	WatchDoneDir   = "done"
+	WatchFailedDir = "failed"
+)
+
+// DefaultWatchStateFile is the queue file kept in the output directory
+const DefaultWatchStateFile = ".video_compressor_watch.json"
+
+// WatchOptions configures Watch
+type WatchOptions struct {
+	Dirs      []string          // Directories to watch (not recursive)
+	OutputDir string            // Directory receiving the outputs
+	Interval  time.Duration     // Time between directory scans
+	StableFor time.Duration     // Time a file's size and modification time must stay unchanged
+	StateFile string            // Persisted queue (default: DefaultWatchStateFile in OutputDir)
+	Jobs      *jobs.Store       // Job history recording every file (nil disables)
+	Reprocess bool              // Compress files that a job already processed with the same settings
+	Metrics   *metrics.Registry // Metrics of the processed files (nil disables)
+	Verbose   bool
+}
+
+// Status of a file in the watch queue
+type WatchStatus string
+
+const (
+	WatchQueued     WatchStatus = "queued"
+	WatchProcessing WatchStatus = "processing"
+	WatchDone       WatchStatus = "done"
+	WatchFailed     WatchStatus = "failed"
+)
+
+// watchEntry is a file in the persisted queue
+type watchEntry struct {
+	Size    int64       `json:"size"`
+	ModTime time.Time   `json:"mod_time"`
+	Status  WatchStatus `json:"status"`
+	Updated time.Time   `json:"updated"`
+	Output  string      `json:"output,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// matches reports whether the entry describes the file with the given size and modification time
+func (e watchEntry) matches(size int64, modTime time.Time) bool {
+	return e.Size == size && e.ModTime.Equal(modTime)
+}
+
+// observation is the last seen size and modification time of a file and when they were first seen
+type observation struct {
+	size    int64
+	modTime time.Time
+	since   time.Time
+}
+
+// watcher holds the state of a running Watch
+type watcher struct {
+	opts    WatchOptions
+	process func(ctx context.Context, input, output string) (*Result, error)
+	queue   map[string]watchEntry // By absolute input path
+	seen    map[string]observation
+}
+
+// Watch polls the directories for new videos, waits until they are completely written,
+// compresses them into the output directory and moves the originals to the done or
+// failed folder next to them. The queue is persisted so that a restart neither loses
+// nor reprocesses files. Watch runs until ctx is cancelled; it returns ctx.Err() only
+// if a file was being processed.
+func Watch(ctx context.Context, opts WatchOptions, cfg config.VideoConfig) error {
+	w, err := newWatcher(opts, func(ctx context.Context, input, output string) (*Result, error) {
+		return CompressTracked(ctx, opts.Jobs, input, output, cfg, opts.Verbose, !opts.Reprocess)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Watching %s every %s, output to %s\n", strings.Join(opts.Dirs, ", "), opts.Interval, opts.OutputDir)
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+	for {
+		if err := w.poll(ctx, time.Now()); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// newWatcher validates the options and loads the persisted queue
+func newWatcher(opts WatchOptions, process func(ctx context.Context, input, output string) (*Result, error)) (*watcher, error) {
+	if len(opts.Dirs) == 0 {
+		return nil, fmt.Errorf("no directories to watch")
+	}
+	for i, dir := range opts.Dirs {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, fmt.Errorf("invalid watch directory %s: %v", dir, err)
+		}
+		if info, err := os.Stat(abs); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("watch directory not found: %s", dir)
+		}
+		opts.Dirs[i] = abs
+	}
+	// Outputs written into a watched directory would be picked up as new inputs
+	if out, err := filepath.Abs(opts.OutputDir); err == nil && slices.Contains(opts.Dirs, out) {
+		return nil, fmt.Errorf("the output directory must not be a watched directory: %s", opts.OutputDir)
+	}
+	if err := os.MkdirAll(opts.OutputDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %v", err)
+	}
+	if opts.StateFile == "" {
+		opts.StateFile = filepath.Join(opts.OutputDir, DefaultWatchStateFile)
+	}
+	w := &watcher{opts: opts, process: process, queue: make(map[string]watchEntry), seen: make(map[string]observation)}
+	data, err := os.ReadFile(opts.StateFile)
+	if err == nil {
+		if err := json.Unmarshal(data, &w.queue); err != nil {
+			return nil, fmt.Errorf("invalid watch state file %s: %v", opts.StateFile, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read watch state file: %v", err)
+	}
+	return w, nil
+}
+
+// poll scans the watched directories once, queues the files that are ready and processes them
+func (w *watcher) poll(ctx context.Context, now time.Time) error {
+	ready, pruned := w.scan(now)
+	for _, path := range ready {
+		if _, queued := w.queue[path]; !queued {
+			obs := w.seen[path]
+			w.queue[path] = watchEntry{Size: obs.size, ModTime: obs.modTime, Status: WatchQueued, Updated: now}
+		}
+	}
+	if len(ready) > 0 || pruned {
+		if err := w.save(); err != nil {
+			return err
+		}
+	}
+	for i, path := range ready {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if w.opts.Metrics != nil {
+			w.opts.Metrics.SetQueued(len(ready) - i - 1)
+		}
+		if err := w.handle(ctx, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scan updates the observations and returns the files that are ready to be processed:
+// queued before a restart, or unchanged for StableFor. Queue entries of files that no
+// longer exist are dropped; pruned reports whether there were any.
+func (w *watcher) scan(now time.Time) (ready []string, pruned bool) {
+	present := make(map[string]bool)
+	for _, dir := range w.opts.Dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			fmt.Printf("Warning: cannot read %s: %v\n", dir, err)
+			continue
+		}
+		for _, e := range entries {
+			// Hidden files include the temporary outputs of an output directory that is also watched
+			if e.IsDir() || strings.HasPrefix(e.Name(), ".") || !ffmpeg.IsSupportedFormat(e.Name()) {
+				continue
+			}
+			info, err := e.Info()
+			if err != nil {
+				continue
+			}
+			path := filepath.Join(dir, e.Name())
+			present[path] = true
+			size, modTime := info.Size(), info.ModTime()
+
+			entry, known := w.queue[path]
+			if known && entry.matches(size, modTime) {
+				if entry.Status == WatchQueued || entry.Status == WatchProcessing {
+					ready = append(ready, path)
+				}
+				// Done or failed files that could not be moved away are not processed again
+				continue
+			}
+			obs, ok := w.seen[path]
+			if !ok || obs.size != size || !obs.modTime.Equal(modTime) {
+				w.seen[path] = observation{size: size, modTime: modTime, since: now}
+				continue
+			}
+			if now.Sub(obs.since) >= w.opts.StableFor {
+				ready = append(ready, path)
+			}
+		}
+	}
+	for path := range w.seen {
+		if !present[path] {
+			delete(w.seen, path)
+		}
+	}
+	// E.g. failed files that could not be moved and were deleted by the user since
+	for path := range w.queue {
+		if _, err := os.Stat(path); !present[path] && os.IsNotExist(err) {
+			delete(w.queue, path)
+			pruned = true
+		}
+	}
+	sort.Strings(ready)
+	return ready, pruned
+}
+
+// handle processes one file and moves it to the done or failed folder
+func (w *watcher) handle(ctx context.Context, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		delete(w.seen, path)
+		return nil
+	}
+	entry := watchEntry{Size: info.Size(), ModTime: info.ModTime(), Status: WatchProcessing, Updated: time.Now()}
+	w.queue[path] = entry
+	if err := w.save(); err != nil {
+		return err
+	}
+
+	name := filepath.Base(path)
+	fmt.Printf("Processing %s\n", path)
+	output := filepath.Join(w.opts.OutputDir, strings.TrimSuffix(name, filepath.Ext(name)))
+	if w.opts.Metrics != nil {
+		w.opts.Metrics.AddRunning(1)
+		defer w.opts.Metrics.AddRunning(-1)
+	}
+	result, err := w.process(ctx, path, output)
+	if ctx.Err() != nil {
+		// Left as processing, so it is picked up again after a restart
+		return ctx.Err()
+	}
+	if w.opts.Metrics != nil {
+		w.opts.Metrics.Finished(Outcome(result, err, false))
+	}
+	folder := WatchDoneDir
+	if err != nil {
+		fmt.Printf("❌ Error processing %s: %v\n", path, err)
+		entry.Status, entry.Error, folder = WatchFailed, err.Error(), WatchFailedDir
+	} else {
+		entry.Status, entry.Output = WatchDone, result.Output
+		fmt.Printf("✅ %s: %s\n", result.Decision, path)
+	}
+	entry.Updated = time.Now()
+
+	moved, moveErr := moveToFolder(path, folder)
+	if moveErr != nil {
+		fmt.Printf("Warning: cannot move %s to %s: %v\n", path, folder, moveErr)
+		w.queue[path] = entry
+	} else {
+		// The original is gone, so the queue no longer needs its entry; its jobs are kept
+		// under the new path
+		delete(w.queue, path)
+		if w.opts.Jobs != nil {
+			if err := w.opts.Jobs.Relocate(path, moved); err != nil {
+				fmt.Printf("Warning: %v\n", err)
+			}
+		}
+	}
+	delete(w.seen, path)
+	return w.save()
+}
+
+// save writes the queue atomically
+func (w *watcher) save() error {
+	data, err := json.MarshalIndent(w.queue, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := w.opts.StateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write watch state: %v", err)
+	}
+	if err := os.Rename(tmp, w.opts.StateFile); err != nil {
+		return fmt.Errorf("failed to write watch state: %v", err)
+	}
+	return nil
+}
+
+// moveToFolder moves path into the named folder of its directory, adding a timestamp
+// to the name if the folder already holds a file of that name
+func moveToFolder(path, folder string) (string, error) {
+	dir := filepath.Join(filepath.Dir(path), folder)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	name := filepath.Base(path)
+	dest := filepath.Join(dir, name)
+	if _, err := os.Stat(dest); err == nil {
+		ext := filepath.Ext(name)
+		dest = filepath.Join(dir, fmt.Sprintf("%s_%s%s", strings.TrimSuffix(name, ext), time.Now().Format("20060102_150405"), ext))
+	}
+	return dest, os.Rename(path, dest)
+}
@@ -0,0 +1,90 @@
+package video
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	var processed []string
+	process := func(ctx context.Context, input, output string) (*Result, error) {
+		processed = append(processed, filepath.Base(input))
+		if filepath.Base(input) == "bad.mp4" {
+			return nil, errors.New("invalid video file")
+		}
+		return &Result{Input: input, Output: output + ".mp4", Decision: DecisionEncoded}, nil
+	}
+	opts := WatchOptions{Dirs: []string{in}, OutputDir: out, StableFor: 10 * time.Second}
+	w, err := newWatcher(opts, process)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"a.mp4", "bad.mp4", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(in, name), []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := time.Now()
+	if err := w.poll(context.Background(), start); err != nil {
+		t.Fatal(err)
+	}
+	// Not yet stable
+	if len(processed) != 0 {
+		t.Fatalf("processed %v before the files were stable", processed)
+	}
+	if err := w.poll(context.Background(), start.Add(10*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if len(processed) != 2 || processed[0] != "a.mp4" || processed[1] != "bad.mp4" {
+		t.Fatalf("processed = %v, want [a.mp4 bad.mp4]", processed)
+	}
+	for _, path := range []string{"done/a.mp4", "failed/bad.mp4", "notes.txt"} {
+		if _, err := os.Stat(filepath.Join(in, path)); err != nil {
+			t.Errorf("%s: %v", path, err)
+		}
+	}
+
+	// A restart picks up a file left in processing and skips finished ones
+	pending := filepath.Join(in, "b.mp4")
+	if err := os.WriteFile(pending, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, _ := os.Stat(pending)
+	w.queue[pending] = watchEntry{Size: info.Size(), ModTime: info.ModTime(), Status: WatchProcessing}
+	if err := w.save(); err != nil {
+		t.Fatal(err)
+	}
+	restarted, err := newWatcher(WatchOptions{Dirs: []string{in}, OutputDir: out, StableFor: 10 * time.Second}, process)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := restarted.poll(context.Background(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if len(processed) != 3 || processed[2] != "b.mp4" {
+		t.Errorf("processed = %v, want b.mp4 resumed without waiting", processed)
+	}
+	// Moved files leave the queue
+	if len(restarted.queue) != 0 {
+		t.Errorf("queue = %+v, want it empty once the files are moved", restarted.queue)
+	}
+
+	// Entries of files that no longer exist are pruned
+	restarted.queue[filepath.Join(in, "gone.mp4")] = watchEntry{Status: WatchFailed}
+	if err := restarted.poll(context.Background(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if len(restarted.queue) != 0 {
+		t.Errorf("queue = %+v, want the entry of the deleted file pruned", restarted.queue)
+	}
+
+	if _, err := newWatcher(WatchOptions{Dirs: []string{in}, OutputDir: in}, process); err == nil {
+		t.Error("newWatcher() accepted a watched directory as output")
+	}
+}